@@ -6,19 +6,21 @@ import (
 	"github.com/songzhibin97/mini-compiler/vm"
 
 	"github.com/songzhibin97/mini-compiler/compiler"
+	"github.com/songzhibin97/mini-compiler/lexer"
+	"github.com/songzhibin97/mini-compiler/parser"
 
 	"github.com/songzhibin97/mini-interpreter/eval"
 	"github.com/songzhibin97/mini-interpreter/object"
 
-	"github.com/songzhibin97/mini-interpreter/lexer"
-	"github.com/songzhibin97/mini-interpreter/parser"
+	ilexer "github.com/songzhibin97/mini-interpreter/lexer"
+	iparser "github.com/songzhibin97/mini-interpreter/parser"
 )
 
 var input = `func fibonacci(a) {if (a < 0) { return 0 } else { return fibonacci(a-1) + fibonacci(a-2) }} fibonacci(10)`
 
 func BenchmarkInterpreter(b *testing.B) {
 	env := object.NewEnv(nil)
-	p := parser.NewParser(lexer.NewLexer(input))
+	p := iparser.NewParser(ilexer.NewLexer(input))
 	program := p.ParseProgram()
 	for i := 0; i < b.N; i++ {
 		eval.Eval(program, env)
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"hash/fnv"
+	"sort"
 )
 
 type (
@@ -26,23 +28,35 @@ const (
 	OpMap // hash map
 
 	OpIndex
+	OpSetIndex // 索引赋值 arr[i] = v / m[k] = v
 
 	OpAdd // +
 	OpSub // -
 	OpMul // *
 	OpQuo // /
+	OpRem // %
+	OpAnd // &
+	OpOr  // |
+	OpXor // ^
+	OpShl // <<
+	OpShr // >>
 
 	OpTrue  // true
 	OpFalse // false
 
 	OpEQL // ==
 	OpNEQ // !=
-	OpGTR // >  (通过指令重排满足 < 运算符)
+	OpGTR // >
+	OpLSS // <
+	OpLEQ // <=
+	OpGEQ // >=
 
-	OpMinus // -
-	OpBang  // !
+	OpMinus  // -
+	OpBang   // !
+	OpBitNot // ^ 按位取反
 
 	OpCall        // call func
+	OpTailCall    // 尾调用, 复用当前栈帧
 	OpReturnValue // return value
 	OpReturn      // return nil(隐式返回)
 
@@ -56,10 +70,15 @@ const (
 
 	OpClosure
 	OpContext
+	OpSetContext     // 修改闭包捕获的变量
+	OpCaptureLocal   // 以引用方式捕获局部变量, 供 OpClosure 使用
+	OpCaptureContext // 将当前闭包捕获的变量传递给内层闭包
 	OpCurrClosure
 
 	OpJump                 // 无条件跳转
 	OpJumpConditionNotTrue // 条件不为真跳转
+	OpJumpNotTrueOrPop     // 栈顶不为真时保留栈顶并跳转, 否则弹出栈顶(&&)
+	OpJumpTrueOrPop        // 栈顶为真时保留栈顶并跳转, 否则弹出栈顶(||)
 
 	OpNil // nil
 )
@@ -106,13 +125,20 @@ var definitions = map[Opcode]*Definition{
 
 	OpMap: {"OpMap", []int{2}}, // 弹栈数量  kv * 2
 
-	OpIndex: {"OpIndex", []int{}},
+	OpIndex:    {"OpIndex", []int{}},
+	OpSetIndex: {"OpSetIndex", []int{}},
 
 	// 算数运算符
 	OpAdd: {"OpAdd", []int{}},
 	OpSub: {"OpSub", []int{}},
 	OpMul: {"OpMul", []int{}},
 	OpQuo: {"OpQuo", []int{}},
+	OpRem: {"OpRem", []int{}},
+	OpAnd: {"OpAnd", []int{}},
+	OpOr:  {"OpOr", []int{}},
+	OpXor: {"OpXor", []int{}},
+	OpShl: {"OpShl", []int{}},
+	OpShr: {"OpShr", []int{}},
 
 	// bool
 	OpTrue:  {"OpTrue", []int{}},
@@ -122,13 +148,18 @@ var definitions = map[Opcode]*Definition{
 	OpEQL: {"OpEQL", []int{}},
 	OpNEQ: {"OpNEQ", []int{}},
 	OpGTR: {"OpGTR", []int{}},
+	OpLSS: {"OpLSS", []int{}},
+	OpLEQ: {"OpLEQ", []int{}},
+	OpGEQ: {"OpGEQ", []int{}},
 
 	// 前缀表达式
-	OpMinus: {"OpMinus", []int{}},
-	OpBang:  {"OpBang", []int{}},
+	OpMinus:  {"OpMinus", []int{}},
+	OpBang:   {"OpBang", []int{}},
+	OpBitNot: {"OpBitNot", []int{}},
 
 	// func
 	OpCall:        {"OpCall", []int{1}}, // call arg len
+	OpTailCall:    {"OpTailCall", []int{1}},
 	OpReturnValue: {"OpReturnValue", []int{}},
 	OpReturn:      {"OpReturn", []int{}},
 
@@ -142,13 +173,18 @@ var definitions = map[Opcode]*Definition{
 	OpGetLocal: {"OpGetLocal", []int{1}},
 	OpSetLocal: {"OpSetLocal", []int{1}},
 
-	OpClosure:     {"OpClosure", []int{2, 1}}, // OpConstant index, count closure
-	OpContext:     {"OpContext", []int{1}},
-	OpCurrClosure: {"OpCurrClosure", []int{}},
+	OpClosure:        {"OpClosure", []int{2, 1}}, // OpConstant index, count closure
+	OpContext:        {"OpContext", []int{1}},
+	OpSetContext:     {"OpSetContext", []int{1}},
+	OpCaptureLocal:   {"OpCaptureLocal", []int{1}},
+	OpCaptureContext: {"OpCaptureContext", []int{1}},
+	OpCurrClosure:    {"OpCurrClosure", []int{}},
 
 	// 指令跳转
 	OpJump:                 {"OpJump", []int{2}},                 // jump: address
 	OpJumpConditionNotTrue: {"OpJumpConditionNotTrue", []int{2}}, // jump: address
+	OpJumpNotTrueOrPop:     {"OpJumpNotTrueOrPop", []int{2}},     // jump: address
+	OpJumpTrueOrPop:        {"OpJumpTrueOrPop", []int{2}},        // jump: address
 
 	OpNil: {"OpNil", []int{}},
 }
@@ -162,6 +198,27 @@ func FindDefinitionByOp(op byte) (*Definition, error) {
 	return v, nil
 }
 
+// Hash 计算当前指令集的摘要, 指令集(操作码/名称/操作数宽度)发生变化时摘要随之变化
+// 用于校验序列化后的字节码与当前虚拟机是否兼容
+func Hash() uint64 {
+	ops := make([]int, 0, len(definitions))
+	for op := range definitions {
+		ops = append(ops, int(op))
+	}
+	sort.Ints(ops)
+
+	h := fnv.New64a()
+	for _, op := range ops {
+		def := definitions[Opcode(op)]
+		_, _ = h.Write([]byte{byte(op)})
+		_, _ = h.Write([]byte(def.Name))
+		for _, w := range def.OperandWidths {
+			_, _ = h.Write([]byte{byte(w)})
+		}
+	}
+	return h.Sum64()
+}
+
 // ReadOperands 读取运算常量
 func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 	operands := make([]int, len(def.OperandWidths))
@@ -0,0 +1,183 @@
+package compiler
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/songzhibin97/mini-interpreter/object"
+)
+
+// Variadic 参数数量不固定的内置函数
+const Variadic = -1
+
+// MaxBuiltins OpGetBuiltin 的操作数为 1 字节, 最多注册 256 个内置函数
+const MaxBuiltins = math.MaxUint8 + 1
+
+// Runtime 内置函数可以使用的虚拟机能力, 由 vm.VM 实现
+type Runtime interface {
+	// Call 调用闭包或内置函数并返回结果, 内置函数可以借此回调脚本中的函数
+	Call(fn object.Object, args ...object.Object) (object.Object, error)
+	// Stdin/Stdout/Stderr 虚拟机配置的输入输出, 默认为 os.Stdin/os.Stdout/os.Stderr
+	Stdin() io.Reader
+	Stdout() io.Writer
+	Stderr() io.Writer
+}
+
+// BuiltinFunction 内置函数, 返回的 error 会作为运行时错误终止虚拟机
+type BuiltinFunction func(rt Runtime, args ...object.Object) (object.Object, error)
+
+type Builtin struct {
+	Fn    BuiltinFunction
+	Name  string
+	Arity int // 参数数量, Variadic 表示不检查
+}
+
+func (b *Builtin) Type() object.Type { return object.BUILTIN }
+func (b *Builtin) Inspect() string {
+	return fmt.Sprintf("Builtin[%s]", b.Name)
+}
+
+// Builtins 内置函数注册表, 编译与运行同一份字节码时需使用相同的注册表
+// 函数按注册顺序编号(即 OpGetBuiltin 的操作数), 顺序固定, 序列化后的字节码依赖该顺序
+// 注册应在编译/运行前完成, 运行期间不是并发安全的
+type Builtins struct {
+	list  []*Builtin
+	index map[string]int
+}
+
+// NewBuiltins 创建空的注册表
+func NewBuiltins() *Builtins {
+	return &Builtins{index: map[string]int{}}
+}
+
+// DefaultBuiltins 创建包含 len/print/int/float 的注册表, 每次调用返回新的实例
+func DefaultBuiltins() *Builtins {
+	b := NewBuiltins()
+	_ = b.Register("len", 1, builtinLen)
+	_ = b.Register("print", Variadic, builtinPrint)
+	_ = b.Register("int", 1, builtinInt)
+	_ = b.Register("float", 1, builtinFloat)
+	return b
+}
+
+// Register 注册内置函数, 名称重复或数量超出限制时返回错误
+func (b *Builtins) Register(name string, arity int, fn BuiltinFunction) error {
+	if _, ok := b.index[name]; ok {
+		return fmt.Errorf("builtin %s is already registered", name)
+	}
+	if len(b.list) >= MaxBuiltins {
+		return fmt.Errorf("too many builtins: limited to %d", MaxBuiltins)
+	}
+	if arity < Variadic {
+		return fmt.Errorf("invalid arity %d for builtin %s", arity, name)
+	}
+	b.index[name] = len(b.list)
+	b.list = append(b.list, &Builtin{Fn: fn, Name: name, Arity: arity})
+	return nil
+}
+
+// RegisterFunc 通过反射注册普通 Go 函数, 参数与返回值自动转换, 见 WrapFunc
+func (b *Builtins) RegisterFunc(name string, fn interface{}) error {
+	wrapped, arity, err := WrapFunc(name, fn)
+	if err != nil {
+		return err
+	}
+	return b.Register(name, arity, wrapped)
+}
+
+// Get 根据编号获取内置函数, 不存在时返回 nil
+func (b *Builtins) Get(idx int) *Builtin {
+	if idx < 0 || idx >= len(b.list) {
+		return nil
+	}
+	return b.list[idx]
+}
+
+// Lookup 根据名称获取内置函数
+func (b *Builtins) Lookup(name string) (*Builtin, bool) {
+	idx, ok := b.index[name]
+	if !ok {
+		return nil, false
+	}
+	return b.list[idx], true
+}
+
+// Names 按编号顺序返回所有内置函数名
+func (b *Builtins) Names() []string {
+	res := make([]string, 0, len(b.list))
+	for _, builtin := range b.list {
+		res = append(res, builtin.Name)
+	}
+	return res
+}
+
+// Define 将内置函数定义到符号表中
+func (b *Builtins) Define(symbolTable *SymbolTable) {
+	for idx, builtin := range b.list {
+		symbolTable.DefineBuiltin(idx, builtin.Name)
+	}
+}
+
+func builtinLen(_ Runtime, args ...object.Object) (object.Object, error) {
+	switch arg := args[0].(type) {
+	case *object.Map:
+		return &object.Integer{Value: int64(len(arg.Elements))}, nil
+	case *object.Array:
+		return &object.Integer{Value: int64(len(arg.Elements))}, nil
+	case *object.Stringer:
+		return &object.Integer{Value: int64(len(arg.Value))}, nil
+	default:
+		return &object.Error{Error: fmt.Sprintf("argument to `len` not supported, got %s", args[0].Type())}, nil
+	}
+}
+
+func builtinPrint(rt Runtime, args ...object.Object) (object.Object, error) {
+	for _, arg := range args {
+		_, err := fmt.Fprintln(rt.Stdout(), arg.Inspect())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return Nil, nil
+}
+
+// builtinInt 转换为整数, 浮点数向零截断, 字符串按十进制解析
+func builtinInt(_ Runtime, args ...object.Object) (object.Object, error) {
+	switch arg := args[0].(type) {
+	case *object.Integer:
+		return arg, nil
+	case *Float:
+		if math.IsNaN(arg.Value) || arg.Value >= math.MaxInt64 || arg.Value < math.MinInt64 {
+			return &object.Error{Error: fmt.Sprintf("cannot convert %s to %s", arg.Inspect(), object.INT)}, nil
+		}
+		return &object.Integer{Value: int64(arg.Value)}, nil
+	case *object.Stringer:
+		v, err := strconv.ParseInt(arg.Value, 10, 64)
+		if err != nil {
+			return &object.Error{Error: fmt.Sprintf("cannot convert %q to %s", arg.Value, object.INT)}, nil
+		}
+		return &object.Integer{Value: v}, nil
+	default:
+		return &object.Error{Error: fmt.Sprintf("argument to `int` not supported, got %s", args[0].Type())}, nil
+	}
+}
+
+// builtinFloat 转换为浮点数, 字符串按十进制解析
+func builtinFloat(_ Runtime, args ...object.Object) (object.Object, error) {
+	switch arg := args[0].(type) {
+	case *object.Integer:
+		return &Float{Value: float64(arg.Value)}, nil
+	case *Float:
+		return arg, nil
+	case *object.Stringer:
+		v, err := strconv.ParseFloat(arg.Value, 64)
+		if err != nil {
+			return &object.Error{Error: fmt.Sprintf("cannot convert %q to %s", arg.Value, FLOAT)}, nil
+		}
+		return &Float{Value: v}, nil
+	default:
+		return &object.Error{Error: fmt.Sprintf("argument to `float` not supported, got %s", args[0].Type())}, nil
+	}
+}
@@ -0,0 +1,50 @@
+package compiler
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songzhibin97/mini-compiler/code"
+	"github.com/songzhibin97/mini-interpreter/object"
+)
+
+func TestBuiltinsRegistry(t *testing.T) {
+	nop := func(_ Runtime, args ...object.Object) (object.Object, error) { return nil, nil }
+
+	builtins := NewBuiltins()
+	assert.NoError(t, builtins.Register("a", 0, nop))
+	assert.NoError(t, builtins.Register("b", Variadic, nop))
+	assert.Error(t, builtins.Register("a", 1, nop))
+	assert.Error(t, builtins.Register("c", -2, nop))
+	assert.Equal(t, []string{"a", "b"}, builtins.Names())
+
+	b, ok := builtins.Lookup("b")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, Variadic, b.Arity)
+	assert.Equal(t, b, builtins.Get(1))
+	assert.Nil(t, builtins.Get(2))
+	_, ok = builtins.Lookup("c")
+	assert.Equal(t, false, ok)
+
+	// 编号即注册顺序
+	compiler := NewCompilerWithBuiltins(builtins)
+	assert.NoError(t, compiler.Compiler(parse(`b(a())`)))
+	testInstructions(t, []code.Instructions{
+		code.Make(code.OpGetBuiltin, 1),
+		code.Make(code.OpGetBuiltin, 0),
+		code.Make(code.OpCall, 0),
+		code.Make(code.OpCall, 1),
+		code.Make(code.OpPop),
+	}, compiler.Bytecode().Instructions)
+	assert.Error(t, NewCompilerWithBuiltins(builtins).Compiler(parse(`len("")`)))
+
+	assert.Equal(t, []string{"len", "print", "int", "float"}, DefaultBuiltins().Names())
+
+	full := NewBuiltins()
+	for i := 0; i < MaxBuiltins; i++ {
+		assert.NoError(t, full.Register("f"+strconv.Itoa(i), 0, nop))
+	}
+	assert.Error(t, full.Register("overflow", 0, nop))
+}
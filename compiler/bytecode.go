@@ -0,0 +1,298 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/songzhibin97/mini-compiler/code"
+	"github.com/songzhibin97/mini-interpreter/object"
+)
+
+// 字节码文件格式(大端序):
+//
+//	magic        [4]byte  "MINC"
+//	version      uint16   格式版本
+//	opcodeHash   uint64   code.Hash() 指令集摘要
+//	file         uint32 长度 + 源文件名
+//	instructions uint32 长度 + 指令
+//	positions    uint32 数量 + 位置表(每项 offset/line/column 各 uint32)
+//	constants    uint32 数量 + 常量池(每项 1 字节类型标记 + 数据)
+//	builtins     uint32 数量 + 引用的内置函数名(每项 uint32 长度 + 名称, 未引用为空)
+const (
+	bytecodeMagic   = "MINC"
+	BytecodeVersion = 5
+)
+
+// 常量池类型标记
+const (
+	constantInteger byte = iota + 1
+	constantString
+	constantFunction
+	constantFloat
+)
+
+var (
+	ErrInvalidMagic       = errors.New("bytecode: invalid magic header")
+	ErrUnsupportedVersion = errors.New("bytecode: unsupported format version")
+	ErrOpcodeMismatch     = errors.New("bytecode: opcode set mismatch")
+	ErrTruncated          = errors.New("bytecode: unexpected end of data")
+)
+
+// IsBytecode 判断数据是否以字节码文件头开始
+func IsBytecode(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(bytecodeMagic))
+}
+
+// Encode 将字节码序列化写入 w
+func (b *Bytecode) Encode(w io.Writer) error {
+	data, err := b.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// MarshalBinary 实现 encoding.BinaryMarshaler
+func (b *Bytecode) MarshalBinary() ([]byte, error) {
+	e := &encoder{}
+	e.buf.WriteString(bytecodeMagic)
+	e.uint16(BytecodeVersion)
+	e.uint64(code.Hash())
+	e.bytes([]byte(b.File))
+	e.bytes(b.Instructions)
+	e.positions(b.Positions)
+
+	e.uint32(uint32(len(b.Constants)))
+	for _, constant := range b.Constants {
+		err := e.constant(constant)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	e.uint32(uint32(len(b.Builtins)))
+	for _, name := range b.Builtins {
+		e.bytes([]byte(name))
+	}
+	return e.buf.Bytes(), nil
+}
+
+// Decode 从 r 中读取并反序列化字节码
+func Decode(r io.Reader) (*Bytecode, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	b := &Bytecode{}
+	err = b.UnmarshalBinary(data)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// UnmarshalBinary 实现 encoding.BinaryUnmarshaler, 解码后会校验指令(见 validate)
+// 引用的内置函数需在加载时通过 CheckBuiltins 与运行时的注册表比对
+func (b *Bytecode) UnmarshalBinary(data []byte) error {
+	d := &decoder{data: data}
+	if string(d.next(len(bytecodeMagic))) != bytecodeMagic {
+		return ErrInvalidMagic
+	}
+	if version := d.uint16(); d.err == nil && version != BytecodeVersion {
+		return fmt.Errorf("%w: got %d, want %d", ErrUnsupportedVersion, version, BytecodeVersion)
+	}
+	if hash := d.uint64(); d.err == nil && hash != code.Hash() {
+		return ErrOpcodeMismatch
+	}
+	file := string(d.bytes())
+	instructions := code.Instructions(d.bytes())
+	positions := d.positions()
+
+	count := d.uint32()
+	constants := make([]object.Object, 0)
+	for i := uint32(0); i < count && d.err == nil; i++ {
+		constants = append(constants, d.constant())
+	}
+
+	count = d.uint32()
+	var builtins []string
+	for i := uint32(0); i < count && d.err == nil; i++ {
+		builtins = append(builtins, string(d.bytes()))
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if len(d.data) != 0 {
+		return fmt.Errorf("bytecode: %d trailing bytes", len(d.data))
+	}
+
+	decoded := &Bytecode{
+		Instructions: instructions,
+		Constants:    constants,
+		Positions:    positions,
+		File:         file,
+		Builtins:     builtins,
+	}
+	err := decoded.validate()
+	if err != nil {
+		return err
+	}
+	*b = *decoded
+	return nil
+}
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) uint16(v uint16) {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], v)
+	e.buf.Write(b[:])
+}
+
+func (e *encoder) uint32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	e.buf.Write(b[:])
+}
+
+func (e *encoder) uint64(v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	e.buf.Write(b[:])
+}
+
+func (e *encoder) bytes(v []byte) {
+	e.uint32(uint32(len(v)))
+	e.buf.Write(v)
+}
+
+func (e *encoder) positions(t PosTable) {
+	e.uint32(uint32(len(t)))
+	for _, entry := range t {
+		e.uint32(uint32(entry.Offset))
+		e.uint32(uint32(entry.Pos.Line))
+		e.uint32(uint32(entry.Pos.Column))
+	}
+}
+
+func (e *encoder) constant(obj object.Object) error {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		e.buf.WriteByte(constantInteger)
+		e.uint64(uint64(obj.Value))
+	case *object.Stringer:
+		e.buf.WriteByte(constantString)
+		e.bytes([]byte(obj.Value))
+	case *Float:
+		e.buf.WriteByte(constantFloat)
+		e.uint64(math.Float64bits(obj.Value))
+	case *CompiledFunction:
+		e.buf.WriteByte(constantFunction)
+		e.bytes([]byte(obj.Name))
+		e.uint32(uint32(obj.NumLocals))
+		e.uint32(uint32(obj.NumParameters))
+		e.bytes(obj.Instructions)
+		e.positions(obj.Positions)
+	default:
+		return fmt.Errorf("bytecode: unsupported constant type %s", obj.Type())
+	}
+	return nil
+}
+
+type decoder struct {
+	data []byte
+	err  error
+}
+
+// next 读取 n 个字节, 数据不足时记录 ErrTruncated 并返回 nil
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.data) {
+		d.err = ErrTruncated
+		return nil
+	}
+	v := d.data[:n]
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *decoder) uint16() uint16 {
+	v := d.next(2)
+	if v == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(v)
+}
+
+func (d *decoder) uint32() uint32 {
+	v := d.next(4)
+	if v == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(v)
+}
+
+func (d *decoder) uint64() uint64 {
+	v := d.next(8)
+	if v == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(v)
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.uint32()
+	v := d.next(int(n))
+	if v == nil {
+		return nil
+	}
+	// 拷贝一份, 避免与输入数据共享底层数组
+	return append([]byte{}, v...)
+}
+
+func (d *decoder) positions() PosTable {
+	count := d.uint32()
+	var t PosTable
+	for i := uint32(0); i < count && d.err == nil; i++ {
+		entry := PosEntry{Offset: int(d.uint32())}
+		entry.Pos.Line = int(d.uint32())
+		entry.Pos.Column = int(d.uint32())
+		t = append(t, entry)
+	}
+	return t
+}
+
+func (d *decoder) constant() object.Object {
+	tag := d.next(1)
+	if tag == nil {
+		return nil
+	}
+	switch tag[0] {
+	case constantInteger:
+		return &object.Integer{Value: int64(d.uint64())}
+	case constantString:
+		return &object.Stringer{Value: string(d.bytes())}
+	case constantFloat:
+		return &Float{Value: math.Float64frombits(d.uint64())}
+	case constantFunction:
+		fn := &CompiledFunction{}
+		fn.Name = string(d.bytes())
+		fn.NumLocals = int(d.uint32())
+		fn.NumParameters = int(d.uint32())
+		fn.Instructions = d.bytes()
+		fn.Positions = d.positions()
+		return fn
+	default:
+		d.err = fmt.Errorf("bytecode: unknown constant tag %d", tag[0])
+		return nil
+	}
+}
@@ -0,0 +1,305 @@
+package compiler
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songzhibin97/mini-compiler/code"
+	"github.com/songzhibin97/mini-interpreter/object"
+)
+
+func TestBytecode_Encode(t *testing.T) {
+	inputs := []string{
+		"",
+		"1 + 2",
+		`"mini" + "-" + "compiler"`,
+		"[1, 2, 3][1]",
+		`{1: "a", 2: "b"}`,
+		"-9223372036854775807",
+		"1.5 + 0.1 * 3",
+		`func test1(a) {func test2(b) { func test3(c) {return a + b + c}}}`,
+		`var a = 1 func add(b) { if (a > b) { a } else { b } } add(2)`,
+		`print(int(1.5), len("abc"))`,
+	}
+	for _, input := range inputs {
+		comp := NewCompiler()
+		assert.NoError(t, comp.Compiler(parse(input)))
+		expected := comp.Bytecode()
+
+		buf := bytes.Buffer{}
+		assert.NoError(t, expected.Encode(&buf))
+
+		actual, err := Decode(&buf)
+		assert.NoError(t, err)
+		assert.Equal(t, expected.Instructions.String(), actual.Instructions.String())
+		assert.Equal(t, expected.Positions, actual.Positions)
+		assert.Equal(t, expected.Builtins, actual.Builtins)
+		assert.Equal(t, len(expected.Constants), len(actual.Constants))
+		for i, constant := range expected.Constants {
+			switch constant := constant.(type) {
+			case *CompiledFunction:
+				fn, ok := actual.Constants[i].(*CompiledFunction)
+				assert.Equal(t, ok, true)
+				assert.Equal(t, constant.Name, fn.Name)
+				assert.Equal(t, constant.Instructions, fn.Instructions)
+				assert.Equal(t, constant.NumLocals, fn.NumLocals)
+				assert.Equal(t, constant.NumParameters, fn.NumParameters)
+				assert.Equal(t, constant.Positions, fn.Positions)
+			default:
+				assert.Equal(t, constant, actual.Constants[i])
+			}
+		}
+	}
+}
+
+func TestBytecode_UnmarshalBinary(t *testing.T) {
+	valid, err := (&Bytecode{
+		Instructions: code.Make(code.OpConstant, 0),
+		Constants:    []object.Object{&object.Integer{Value: 1}},
+	}).MarshalBinary()
+	assert.NoError(t, err)
+
+	version := append([]byte{}, valid...)
+	version[5]++
+
+	hash := append([]byte{}, valid...)
+	hash[6]++
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{name: "empty", data: nil, want: ErrInvalidMagic},
+		{name: "magic", data: []byte("MINI"), want: ErrInvalidMagic},
+		{name: "version", data: version, want: ErrUnsupportedVersion},
+		{name: "hash", data: hash, want: ErrOpcodeMismatch},
+		{name: "truncated", data: valid[:len(valid)-1], want: ErrTruncated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&Bytecode{}).UnmarshalBinary(tt.data)
+			assert.Equal(t, true, errors.Is(err, tt.want), "got %v", err)
+		})
+	}
+
+	assert.Error(t, (&Bytecode{}).UnmarshalBinary(append(valid, 0)))
+	assert.NoError(t, (&Bytecode{}).UnmarshalBinary(valid))
+}
+
+func TestBytecode_Validate(t *testing.T) {
+	concat := func(ins ...[]byte) code.Instructions {
+		var out code.Instructions
+		for _, i := range ins {
+			out = append(out, i...)
+		}
+		return out
+	}
+	integer := &object.Integer{Value: 1}
+	// 函数体末尾补上 OpReturnValue
+	fn := func(ins code.Instructions, numLocals int) *CompiledFunction {
+		ins = concat(ins, code.Make(code.OpReturnValue))
+		return &CompiledFunction{Name: "f", Instructions: ins, NumLocals: numLocals}
+	}
+
+	tests := []struct {
+		name     string
+		bytecode *Bytecode
+		err      bool
+	}{
+		{
+			name:     "unknown opcode",
+			bytecode: &Bytecode{Instructions: code.Instructions{255}},
+			err:      true,
+		},
+		{
+			name:     "truncated operand",
+			bytecode: &Bytecode{Instructions: code.Make(code.OpConstant, 0)[:2], Constants: []object.Object{integer}},
+			err:      true,
+		},
+		{
+			name:     "constant out of range",
+			bytecode: &Bytecode{Instructions: code.Make(code.OpConstant, 1), Constants: []object.Object{integer}},
+			err:      true,
+		},
+		{
+			name:     "constant is function",
+			bytecode: &Bytecode{Instructions: code.Make(code.OpConstant, 0), Constants: []object.Object{fn(nil, 0)}},
+			err:      true,
+		},
+		{
+			name:     "closure of integer",
+			bytecode: &Bytecode{Instructions: code.Make(code.OpClosure, 0, 0), Constants: []object.Object{integer}},
+			err:      true,
+		},
+		{
+			name:     "closure out of range",
+			bytecode: &Bytecode{Instructions: code.Make(code.OpClosure, 0, 0)},
+			err:      true,
+		},
+		{
+			name:     "jump into operand",
+			bytecode: &Bytecode{Instructions: concat(code.Make(code.OpJump, 1), code.Make(code.OpTrue))},
+			err:      true,
+		},
+		{
+			name:     "jump to end",
+			bytecode: &Bytecode{Instructions: concat(code.Make(code.OpJump, 4), code.Make(code.OpTrue))},
+		},
+		{
+			name:     "builtin not recorded",
+			bytecode: &Bytecode{Instructions: code.Make(code.OpGetBuiltin, 1), Builtins: []string{"len"}},
+			err:      true,
+		},
+		{
+			name:     "builtin recorded",
+			bytecode: &Bytecode{Instructions: code.Make(code.OpGetBuiltin, 1), Builtins: []string{"", "print"}},
+		},
+		{
+			name:     "local in main",
+			bytecode: &Bytecode{Instructions: code.Make(code.OpGetLocal, 0)},
+			err:      true,
+		},
+		{
+			name: "local out of range",
+			bytecode: &Bytecode{
+				Instructions: code.Make(code.OpClosure, 0, 0),
+				Constants:    []object.Object{fn(concat(code.Make(code.OpTrue), code.Make(code.OpSetLocal, 1), code.Make(code.OpNil)), 1)},
+			},
+			err: true,
+		},
+		{
+			name: "context out of range",
+			bytecode: &Bytecode{
+				Instructions: concat(code.Make(code.OpNil), code.Make(code.OpClosure, 0, 1)),
+				Constants:    []object.Object{fn(code.Make(code.OpContext, 1), 0)},
+			},
+			err: true,
+		},
+		{
+			name: "context captured",
+			bytecode: &Bytecode{
+				Instructions: concat(code.Make(code.OpNil), code.Make(code.OpNil), code.Make(code.OpClosure, 0, 2)),
+				Constants:    []object.Object{fn(code.Make(code.OpContext, 1), 0)},
+			},
+		},
+		{
+			name:     "pop empty stack",
+			bytecode: &Bytecode{Instructions: code.Make(code.OpPop)},
+			err:      true,
+		},
+		{
+			name:     "add on short stack",
+			bytecode: &Bytecode{Instructions: concat(code.Make(code.OpTrue), code.Make(code.OpAdd))},
+			err:      true,
+		},
+		{
+			name:     "call without callee",
+			bytecode: &Bytecode{Instructions: concat(code.Make(code.OpTrue), code.Make(code.OpCall, 1))},
+			err:      true,
+		},
+		{
+			name:     "closure without captured values",
+			bytecode: &Bytecode{Instructions: code.Make(code.OpClosure, 0, 1), Constants: []object.Object{fn(code.Make(code.OpNil), 0)}},
+			err:      true,
+		},
+		{
+			// 条件跳转弹出条件, 两个分支都不能再弹出
+			name: "underflow after branch",
+			bytecode: &Bytecode{Instructions: concat(
+				code.Make(code.OpTrue), code.Make(code.OpJumpConditionNotTrue, 4), code.Make(code.OpPop),
+			)},
+			err: true,
+		},
+		{
+			// 每次循环少一个元素, 最终弹空
+			name: "loop drains stack",
+			bytecode: &Bytecode{Instructions: concat(
+				code.Make(code.OpTrue), code.Make(code.OpTrue), code.Make(code.OpPop), code.Make(code.OpPop), code.Make(code.OpJump, 1),
+			)},
+			err: true,
+		},
+		{
+			name: "balanced loop",
+			bytecode: &Bytecode{Instructions: concat(
+				code.Make(code.OpTrue), code.Make(code.OpJumpConditionNotTrue, 7), code.Make(code.OpJump, 0),
+			)},
+		},
+		{
+			name:     "return in main",
+			bytecode: &Bytecode{Instructions: concat(code.Make(code.OpTrue), code.Make(code.OpReturnValue))},
+			err:      true,
+		},
+		{
+			name: "tail call in main",
+			bytecode: &Bytecode{
+				Instructions: concat(code.Make(code.OpClosure, 0, 0), code.Make(code.OpTailCall, 0)),
+				Constants:    []object.Object{fn(code.Make(code.OpNil), 0)},
+			},
+			err: true,
+		},
+		{
+			name: "function without return",
+			bytecode: &Bytecode{
+				Instructions: code.Make(code.OpClosure, 0, 0),
+				Constants:    []object.Object{&CompiledFunction{Name: "f", Instructions: code.Make(code.OpNil)}},
+			},
+			err: true,
+		},
+		{
+			name: "function pops caller stack",
+			bytecode: &Bytecode{
+				Instructions: concat(code.Make(code.OpTrue), code.Make(code.OpClosure, 0, 0)),
+				Constants:    []object.Object{fn(nil, 0)},
+			},
+			err: true,
+		},
+		{
+			name: "invalid function body",
+			bytecode: &Bytecode{
+				Instructions: code.Make(code.OpClosure, 0, 0),
+				Constants:    []object.Object{fn(code.Make(code.OpConstant, 0), 0)},
+			},
+			err: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.bytecode.MarshalBinary()
+			assert.NoError(t, err)
+			err = (&Bytecode{}).UnmarshalBinary(data)
+			if tt.err {
+				assert.Equal(t, true, errors.Is(err, ErrInvalidInstruction), "got %v", err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestBytecode_CheckBuiltins(t *testing.T) {
+	comp := NewCompiler()
+	assert.NoError(t, comp.Compiler(parse(`print(len("abc"))`)))
+	bytecode := comp.Bytecode()
+	assert.Equal(t, []string{"len", "print"}, bytecode.Builtins)
+	assert.NoError(t, bytecode.CheckBuiltins(DefaultBuiltins()))
+
+	// 编号相同但名称不同
+	swapped := NewBuiltins()
+	assert.NoError(t, swapped.Register("print", Variadic, builtinPrint))
+	assert.NoError(t, swapped.Register("len", 1, builtinLen))
+	assert.Equal(t, true, errors.Is(bytecode.CheckBuiltins(swapped), ErrBuiltinMismatch))
+
+	// 注册表中缺少引用的函数
+	partial := NewBuiltins()
+	assert.NoError(t, partial.Register("len", 1, builtinLen))
+	assert.Equal(t, true, errors.Is(bytecode.CheckBuiltins(partial), ErrBuiltinMismatch))
+
+	// 只比较引用到的函数, 其余可以不同
+	extended := DefaultBuiltins()
+	assert.NoError(t, extended.Register("double", 1, builtinLen))
+	assert.NoError(t, bytecode.CheckBuiltins(extended))
+}
@@ -5,8 +5,9 @@ import (
 	"math"
 	"sort"
 
+	"github.com/songzhibin97/mini-compiler/ast"
 	"github.com/songzhibin97/mini-compiler/code"
-	"github.com/songzhibin97/mini-interpreter/ast"
+	"github.com/songzhibin97/mini-compiler/token"
 	"github.com/songzhibin97/mini-interpreter/object"
 )
 
@@ -20,23 +21,43 @@ type (
 
 	CompilationScope struct {
 		instructions code.Instructions // 指令
+		positions    PosTable          // 指令对应的源码位置
 
 		lastInstruction EmittedInstruction
 		preInstruction  EmittedInstruction
+
+		loops []*loopScope // 嵌套的循环, 最后一个为最内层
+	}
+
+	// loopScope 记录循环内 break/continue 跳转指令的位置, 循环结束时回填
+	loopScope struct {
+		breaks    []int
+		continues []int
 	}
 
 	Compiler struct {
-		constants []object.Object
+		constants     []object.Object
+		constantIndex map[constantKey]int // 常量去重
 
 		symbolTable *SymbolTable
+		builtins    []string // 引用的内置函数名, 下标为内置函数编号
 
 		scopes     []CompilationScope
 		scopeIndex int
+
+		file string         // 源文件名
+		pos  token.Position // 当前编译节点的位置
+
+		folding  bool // 是否开启常量折叠
+		peephole bool // 是否开启窥孔优化
 	}
 
 	Bytecode struct {
 		Instructions code.Instructions // 指令
 		Constants    []object.Object
+		Positions    PosTable // 指令对应的源码位置
+		File         string   // 源文件名
+		Builtins     []string // 引用的内置函数名, 下标为 OpGetBuiltin 的操作数, 未引用的为空
 	}
 )
 
@@ -60,7 +81,11 @@ func init() {
 			c.loadSymbol(symbol)
 
 		case *ast.String:
-			c.emit(code.OpConstant, c.addConstant(&object.Stringer{Value: node.Value}))
+			idx, err := c.addConstant(&object.Stringer{Value: node.Value})
+			if err != nil {
+				return err
+			}
+			c.emit(code.OpConstant, idx)
 
 		case *ast.Array:
 			for _, element := range node.Elements {
@@ -129,6 +154,41 @@ func init() {
 				c.emit(code.OpSetLocal, symbol.Index)
 			}
 
+		case *ast.AssignStmt:
+			switch target := node.Target.(type) {
+			case *ast.Identifier:
+				symbol, ok := c.symbolTable.GetDefine(target.Value)
+				if !ok {
+					return fmt.Errorf("undefined variable %s", target.Value)
+				}
+				err := c.Compiler(node.Value)
+				if err != nil {
+					return err
+				}
+				err = c.storeSymbol(symbol)
+				if err != nil {
+					return err
+				}
+
+			case *ast.IndexExpr:
+				err := c.Compiler(target.Left)
+				if err != nil {
+					return err
+				}
+				err = c.Compiler(target.Index)
+				if err != nil {
+					return err
+				}
+				err = c.Compiler(node.Value)
+				if err != nil {
+					return err
+				}
+				c.emit(code.OpSetIndex)
+
+			default:
+				return fmt.Errorf("cannot assign to %s", node.Target)
+			}
+
 		case *ast.BlockStmt:
 			for _, stmt := range node.Stmts {
 				err := c.Compiler(stmt)
@@ -145,6 +205,15 @@ func init() {
 			c.emit(code.OpPop)
 
 		case *ast.IfExpr:
+			if c.folding {
+				cond, ok, err := foldConstant(node.Condition)
+				if err != nil {
+					return err
+				}
+				if ok {
+					return c.compileFoldedIf(node, cond)
+				}
+			}
 			err := c.Compiler(node.Condition)
 			if err != nil {
 				return err
@@ -160,6 +229,9 @@ func init() {
 			if c.lastInstructionIs(code.OpPop) {
 				// 进行删除, 把last指向pre last用于修改fake address
 				c.removeLastPop()
+			} else if !c.lastInstructionIs(code.OpReturnValue) {
+				// 分支没有产生值(空块/var/循环等), 补充nil保证栈平衡
+				c.emit(code.OpNil)
 			}
 			// 在插入一条指令else指令
 			jumpPos := c.emit(code.OpJump, fakeAddress)
@@ -178,6 +250,8 @@ func init() {
 
 				if c.lastInstructionIs(code.OpPop) {
 					c.removeLastPop()
+				} else if !c.lastInstructionIs(code.OpReturnValue) {
+					c.emit(code.OpNil)
 				}
 			}
 
@@ -186,6 +260,9 @@ func init() {
 			c.changeOperand(jumpPos, curPos)
 
 		case *ast.ReturnStmt:
+			if c.scopeIndex == 0 {
+				return fmt.Errorf("return is not in a function")
+			}
 			err := c.Compiler(node.Value)
 			if err != nil {
 				return err
@@ -222,24 +299,110 @@ func init() {
 
 			ctx := c.symbolTable.Context
 			numLocals := c.symbolTable.count
+			positions := c.scopes[c.scopeIndex].positions
 			instructions := c.leaveScope()
+			if c.peephole {
+				instructions, positions = optimize(instructions, positions)
+			}
+			markTailCalls(instructions)
 			for _, symbol := range ctx {
-				c.loadSymbol(symbol)
+				c.captureSymbol(symbol)
 			}
 
 			compiledFn := &CompiledFunction{
+				Name:          node.Name.Value,
 				Instructions:  instructions,
 				NumLocals:     numLocals,
 				NumParameters: len(node.Params),
+				Positions:     positions,
 			}
 
-			c.emit(code.OpClosure, c.addConstant(compiledFn), len(ctx))
+			idx, err := c.addConstant(compiledFn)
+			if err != nil {
+				return err
+			}
+			c.emit(code.OpClosure, idx, len(ctx))
 
 			if symbol.Scope == GlobalScope {
 				c.emit(code.OpSetGlobal, symbol.Index)
 			} else {
 				c.emit(code.OpSetLocal, symbol.Index)
 			}
+			// 函数声明同时也是表达式, 其值为闭包本身
+			c.loadSymbol(symbol)
+
+		case *ast.WhileStmt:
+			start := len(c.curInstructions())
+			err := c.Compiler(node.Condition)
+			if err != nil {
+				return err
+			}
+			jumpNotTrue := c.emit(code.OpJumpConditionNotTrue, fakeAddress)
+
+			c.enterLoop()
+			err = c.Compiler(node.Body)
+			if err != nil {
+				return err
+			}
+			c.emit(code.OpJump, start)
+
+			end := len(c.curInstructions())
+			c.changeOperand(jumpNotTrue, end)
+			c.leaveLoop(end, start)
+
+		case *ast.ForStmt:
+			if node.Init != nil {
+				err := c.Compiler(node.Init)
+				if err != nil {
+					return err
+				}
+			}
+
+			start := len(c.curInstructions())
+			jumpNotTrue := -1
+			if node.Condition != nil {
+				err := c.Compiler(node.Condition)
+				if err != nil {
+					return err
+				}
+				jumpNotTrue = c.emit(code.OpJumpConditionNotTrue, fakeAddress)
+			}
+
+			c.enterLoop()
+			err := c.Compiler(node.Body)
+			if err != nil {
+				return err
+			}
+
+			// continue 跳转到后置语句
+			post := len(c.curInstructions())
+			if node.Post != nil {
+				err = c.Compiler(node.Post)
+				if err != nil {
+					return err
+				}
+			}
+			c.emit(code.OpJump, start)
+
+			end := len(c.curInstructions())
+			if jumpNotTrue != -1 {
+				c.changeOperand(jumpNotTrue, end)
+			}
+			c.leaveLoop(end, post)
+
+		case *ast.BreakStmt:
+			loop := c.curLoop()
+			if loop == nil {
+				return fmt.Errorf("break is not in a loop")
+			}
+			loop.breaks = append(loop.breaks, c.emit(code.OpJump, fakeAddress))
+
+		case *ast.ContinueStmt:
+			loop := c.curLoop()
+			if loop == nil {
+				return fmt.Errorf("continue is not in a loop")
+			}
+			loop.continues = append(loop.continues, c.emit(code.OpJump, fakeAddress))
 
 		case *ast.CallExpr:
 			err := c.Compiler(node.Func)
@@ -256,22 +419,49 @@ func init() {
 			c.emit(code.OpCall, len(node.Args))
 
 		case *ast.Integer:
-			c.emit(code.OpConstant, c.addConstant(&object.Integer{
+			idx, err := c.addConstant(&object.Integer{
+				Value: node.Value,
+			})
+			if err != nil {
+				return err
+			}
+			c.emit(code.OpConstant, idx)
+
+		case *ast.Float:
+			idx, err := c.addConstant(&Float{
 				Value: node.Value,
-			}))
+			})
+			if err != nil {
+				return err
+			}
+			c.emit(code.OpConstant, idx)
 
 		case *ast.InfixExpr:
-			if node.Operator == "<" {
-				// 指令重排
-				err := c.Compiler(node.Right)
+			if c.folding {
+				obj, ok, err := foldConstant(node)
 				if err != nil {
 					return err
 				}
-				err = c.Compiler(node.Left)
+				if ok {
+					return c.emitFolded(obj)
+				}
+			}
+			if node.Operator == "&&" || node.Operator == "||" {
+				// 短路求值: 左侧能决定结果时保留左侧的值并跳过右侧
+				err := c.Compiler(node.Left)
 				if err != nil {
 					return err
 				}
-				c.emit(code.OpGTR)
+				op := code.OpJumpNotTrueOrPop
+				if node.Operator == "||" {
+					op = code.OpJumpTrueOrPop
+				}
+				jumpPos := c.emit(op, fakeAddress)
+				err = c.Compiler(node.Right)
+				if err != nil {
+					return err
+				}
+				c.changeOperand(jumpPos, len(c.curInstructions()))
 				return nil
 			}
 
@@ -292,8 +482,26 @@ func init() {
 				c.emit(code.OpMul)
 			case "/":
 				c.emit(code.OpQuo)
+			case "%":
+				c.emit(code.OpRem)
+			case "&":
+				c.emit(code.OpAnd)
+			case "|":
+				c.emit(code.OpOr)
+			case "^":
+				c.emit(code.OpXor)
+			case "<<":
+				c.emit(code.OpShl)
+			case ">>":
+				c.emit(code.OpShr)
 			case ">":
 				c.emit(code.OpGTR)
+			case "<":
+				c.emit(code.OpLSS)
+			case "<=":
+				c.emit(code.OpLEQ)
+			case ">=":
+				c.emit(code.OpGEQ)
 			case "==":
 				c.emit(code.OpEQL)
 			case "!=":
@@ -304,6 +512,15 @@ func init() {
 			}
 
 		case *ast.PrefixExpr:
+			if c.folding {
+				obj, ok, err := foldConstant(node)
+				if err != nil {
+					return err
+				}
+				if ok {
+					return c.emitFolded(obj)
+				}
+			}
 			err := c.Compiler(node.Right)
 			if err != nil {
 				return err
@@ -313,6 +530,8 @@ func init() {
 				c.emit(code.OpMinus)
 			case "!":
 				c.emit(code.OpBang)
+			case "^":
+				c.emit(code.OpBitNot)
 			default:
 				return fmt.Errorf("unknown operator %s", node.Operator)
 			}
@@ -336,20 +555,55 @@ func init() {
 var defaultCompiler func(c *Compiler, node ast.Node) error
 
 func (c *Compiler) Compiler(node ast.Node, handler ...func(c *Compiler, node ast.Node) error) error {
+	if node == nil {
+		return nil
+	}
+	// 编译期间发出的指令都记录为当前节点的位置, 子节点编译完成后恢复
+	if pos := node.Position(); pos.IsValid() {
+		pre := c.pos
+		c.pos = pos
+		defer func() { c.pos = pre }()
+	}
 	handler = append(handler, defaultCompiler)
 	return handler[0](c, node)
 }
 
+// SetFile 设置源文件名, 用于运行时错误定位
+func (c *Compiler) SetFile(file string) {
+	c.file = file
+}
+
 func (c *Compiler) Bytecode() *Bytecode {
+	instructions, positions := c.curInstructions(), c.scopes[c.scopeIndex].positions
+	if c.peephole {
+		instructions, positions = optimize(instructions, positions)
+	}
 	return &Bytecode{
-		Instructions: c.curInstructions(),
+		Instructions: instructions,
 		Constants:    c.constants,
+		Positions:    positions,
+		File:         c.file,
+		Builtins:     c.builtins,
 	}
 }
 
-func (c *Compiler) addConstant(obj object.Object) int {
+// addConstant 将常量加入常量池并返回其索引, 相同的整数/字符串常量共用一个索引
+func (c *Compiler) addConstant(obj object.Object) (int, error) {
+	key, ok := newConstantKey(obj)
+	if ok {
+		if idx, ok := c.constantIndex[key]; ok {
+			return idx, nil
+		}
+	}
+	if len(c.constants) >= MaxConstants {
+		return 0, ErrTooManyConstants
+	}
 	c.constants = append(c.constants, obj)
-	return len(c.constants) - 1
+	idx := len(c.constants) - 1
+	if ok {
+		c.constantIndex[key] = idx
+	}
+	return idx, nil
 }
 
 func (c *Compiler) emit(op code.Opcode, operands ...int) int {
@@ -366,6 +620,9 @@ func (c *Compiler) curInstructions() code.Instructions {
 func (c *Compiler) addInstruction(ins []byte) int {
 	posNewInstruction := len(c.curInstructions())
 	c.scopes[c.scopeIndex].instructions = append(c.curInstructions(), ins...)
+	if c.pos.IsValid() {
+		c.scopes[c.scopeIndex].positions = c.scopes[c.scopeIndex].positions.add(posNewInstruction, c.pos)
+	}
 	return posNewInstruction
 }
 
@@ -386,6 +643,7 @@ func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
 
 func (c *Compiler) removeLastPop() {
 	c.scopes[c.scopeIndex].instructions = c.scopes[c.scopeIndex].instructions[:c.scopes[c.scopeIndex].lastInstruction.Pos]
+	c.scopes[c.scopeIndex].positions = c.scopes[c.scopeIndex].positions.truncate(c.scopes[c.scopeIndex].lastInstruction.Pos)
 	c.scopes[c.scopeIndex].lastInstruction = c.scopes[c.scopeIndex].preInstruction
 }
 
@@ -406,6 +664,32 @@ func (c *Compiler) changeOperand(opPos int, operand int) {
 	c.replaceInstruction(opPos, code.Make(op, operand))
 }
 
+func (c *Compiler) enterLoop() {
+	c.scopes[c.scopeIndex].loops = append(c.scopes[c.scopeIndex].loops, &loopScope{})
+}
+
+// leaveLoop 回填当前循环内 break/continue 的跳转地址
+func (c *Compiler) leaveLoop(breakPos, continuePos int) {
+	loops := c.scopes[c.scopeIndex].loops
+	loop := loops[len(loops)-1]
+	for _, pos := range loop.breaks {
+		c.changeOperand(pos, breakPos)
+	}
+	for _, pos := range loop.continues {
+		c.changeOperand(pos, continuePos)
+	}
+	c.scopes[c.scopeIndex].loops = loops[:len(loops)-1]
+}
+
+// curLoop 当前作用域最内层的循环, 不在循环内时返回 nil
+func (c *Compiler) curLoop() *loopScope {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil
+	}
+	return loops[len(loops)-1]
+}
+
 func (c *Compiler) leaveScope() code.Instructions {
 	ins := c.curInstructions()
 	c.scopes = c.scopes[:len(c.scopes)-1]
@@ -431,6 +715,7 @@ func (c *Compiler) loadSymbol(s Symbol) {
 	case LocalScope:
 		c.emit(code.OpGetLocal, s.Index)
 	case BuiltinScope:
+		c.useBuiltin(s)
 		c.emit(code.OpGetBuiltin, s.Index)
 	case ContextScope:
 		c.emit(code.OpContext, s.Index)
@@ -439,28 +724,68 @@ func (c *Compiler) loadSymbol(s Symbol) {
 	}
 }
 
-func NewCompiler() *Compiler {
-	symbolTable := NewSymbolTable()
-	for idx, builtin := range builtins {
-		symbolTable.DefineBuiltin(idx, builtin.Name)
+// useBuiltin 记录引用的内置函数名, 写入字节码供加载时校验
+func (c *Compiler) useBuiltin(s Symbol) {
+	for len(c.builtins) <= s.Index {
+		c.builtins = append(c.builtins, "")
 	}
-	return &Compiler{
-		constants:   []object.Object{},
-		symbolTable: symbolTable,
-		scopes: []CompilationScope{
-			{
-				instructions:    code.Instructions{},
-				lastInstruction: EmittedInstruction{},
-				preInstruction:  EmittedInstruction{},
-			},
-		},
+	c.builtins[s.Index] = s.Name
+}
+
+// captureSymbol 为闭包捕获变量, 局部变量与上下文变量按引用捕获
+func (c *Compiler) captureSymbol(s Symbol) {
+	switch s.Scope {
+	case LocalScope:
+		c.emit(code.OpCaptureLocal, s.Index)
+	case ContextScope:
+		c.emit(code.OpCaptureContext, s.Index)
+	default:
+		c.loadSymbol(s)
+	}
+}
+
+// storeSymbol 将栈顶的值写入变量
+func (c *Compiler) storeSymbol(s Symbol) error {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+	case ContextScope:
+		c.emit(code.OpSetContext, s.Index)
+	case BuiltinScope:
+		return fmt.Errorf("cannot assign to builtin %s", s.Name)
+	default:
+		return fmt.Errorf("cannot assign to function %s", s.Name)
 	}
+	return nil
+}
+
+func NewCompiler() *Compiler {
+	return NewCompilerWithBuiltins(DefaultBuiltins())
+}
+
+// NewCompilerWithBuiltins 使用指定的内置函数注册表创建编译器, 运行时虚拟机需使用同一份注册表(vm.WithBuiltins)
+func NewCompilerWithBuiltins(builtins *Builtins) *Compiler {
+	symbolTable := NewSymbolTable()
+	builtins.Define(symbolTable)
+	return NewCompilerWithSymbol(symbolTable, []object.Object{})
 }
 
 func NewCompilerWithSymbol(symbolTable *SymbolTable, constants []object.Object) *Compiler {
+	// 已有常量(如 REPL 之前的输入)同样参与去重
+	constantIndex := make(map[constantKey]int, len(constants))
+	for idx, constant := range constants {
+		if key, ok := newConstantKey(constant); ok {
+			if _, ok := constantIndex[key]; !ok {
+				constantIndex[key] = idx
+			}
+		}
+	}
 	return &Compiler{
-		constants:   constants,
-		symbolTable: symbolTable,
+		constants:     constants,
+		constantIndex: constantIndex,
+		symbolTable:   symbolTable,
 		scopes: []CompilationScope{
 			{
 				instructions:    code.Instructions{},
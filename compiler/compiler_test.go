@@ -5,11 +5,12 @@ import (
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/songzhibin97/mini-compiler/ast"
 	"github.com/songzhibin97/mini-compiler/code"
-	"github.com/songzhibin97/mini-interpreter/ast"
-	"github.com/songzhibin97/mini-interpreter/lexer"
+	"github.com/songzhibin97/mini-compiler/lexer"
+	"github.com/songzhibin97/mini-compiler/parser"
+	"github.com/songzhibin97/mini-compiler/token"
 	"github.com/songzhibin97/mini-interpreter/object"
-	"github.com/songzhibin97/mini-interpreter/parser"
 )
 
 type compilerTestCase struct {
@@ -45,6 +46,10 @@ func testConstants(t *testing.T, expected []interface{}, actual []object.Object)
 		switch constant := constant.(type) {
 		case int:
 			testIntegerObject(t, int64(constant), actual[i])
+		case float64:
+			result, ok := actual[i].(*Float)
+			assert.Equal(t, ok, true)
+			assert.Equal(t, constant, result.Value)
 		case string:
 			testStringObject(t, constant, actual[i])
 		case []code.Instructions:
@@ -156,6 +161,56 @@ func TestIntegerArithmetic(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input:             "7 % 3 & 2 | 1 ^ 4",
+			expectedConstants: []interface{}{7, 3, 2, 1, 4},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpRem),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpAnd),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpOr),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpXor),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 << 2 >> 1",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpShl),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpShr),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1.5 * 2 - -0.5",
+			expectedConstants: []interface{}{1.5, 2, 0.5},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMul),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpMinus),
+				code.Make(code.OpSub),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "^1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpBitNot),
+				code.Make(code.OpPop),
+			},
+		},
 	}
 	runCompilerTests(t, tests)
 }
@@ -190,11 +245,43 @@ func TestBooleanExpr(t *testing.T) {
 		},
 		{
 			input:             "1 < 2",
-			expectedConstants: []interface{}{2, 1},
+			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
-				code.Make(code.OpGTR),
+				code.Make(code.OpLSS),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "true && false || 1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTrueOrPop, 5),
+				code.Make(code.OpFalse),
+				code.Make(code.OpJumpTrueOrPop, 11),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 <= 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpLEQ),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 >= 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpGEQ),
 				code.Make(code.OpPop),
 			},
 		},
@@ -318,14 +405,14 @@ func TestIndexExpr(t *testing.T) {
 		},
 		{
 			input:             "[1,2,3][1+1]",
-			expectedConstants: []interface{}{1, 2, 3, 1, 1},
+			expectedConstants: []interface{}{1, 2, 3},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpConstant, 2),
 				code.Make(code.OpArray, 3),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpConstant, 4),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 0),
 				code.Make(code.OpAdd),
 				code.Make(code.OpIndex),
 				code.Make(code.OpPop),
@@ -333,29 +420,29 @@ func TestIndexExpr(t *testing.T) {
 		},
 		{
 			input:             "{1:2,3:4}[1]",
-			expectedConstants: []interface{}{1, 2, 3, 4, 1},
+			expectedConstants: []interface{}{1, 2, 3, 4},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpConstant, 2),
 				code.Make(code.OpConstant, 3),
 				code.Make(code.OpMap, 4),
-				code.Make(code.OpConstant, 4),
+				code.Make(code.OpConstant, 0),
 				code.Make(code.OpIndex),
 				code.Make(code.OpPop),
 			},
 		},
 		{
 			input:             "{1:2,3:4}[2-1]",
-			expectedConstants: []interface{}{1, 2, 3, 4, 2, 1},
+			expectedConstants: []interface{}{1, 2, 3, 4},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpConstant, 2),
 				code.Make(code.OpConstant, 3),
 				code.Make(code.OpMap, 4),
-				code.Make(code.OpConstant, 4),
-				code.Make(code.OpConstant, 5),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 0),
 				code.Make(code.OpSub),
 				code.Make(code.OpIndex),
 				code.Make(code.OpPop),
@@ -432,6 +519,7 @@ func TestVarStmtScope(t *testing.T) {
 				code.Make(code.OpSetGlobal, 0),
 				code.Make(code.OpClosure, 1, 0),
 				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 1),
 				code.Make(code.OpPop),
 			},
 		},
@@ -452,6 +540,7 @@ func TestVarStmtScope(t *testing.T) {
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpClosure, 1, 0),
 				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpPop),
 			},
 		},
@@ -478,6 +567,7 @@ func TestVarStmtScope(t *testing.T) {
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpClosure, 2, 0),
 				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpPop),
 			},
 		},
@@ -498,6 +588,7 @@ func TestFuncExpr(t *testing.T) {
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpClosure, 0, 0),
 				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpPop),
 			},
 		},
@@ -515,6 +606,7 @@ func TestFuncExpr(t *testing.T) {
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpClosure, 2, 0),
 				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpPop),
 			},
 		},
@@ -532,6 +624,7 @@ func TestFuncExpr(t *testing.T) {
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpClosure, 2, 0),
 				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpPop),
 			},
 		},
@@ -549,6 +642,7 @@ func TestFuncExpr(t *testing.T) {
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpClosure, 2, 0),
 				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpPop),
 			},
 		},
@@ -571,6 +665,7 @@ func TestCallFuncExpr(t *testing.T) {
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpClosure, 1, 0),
 				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpPop),
 				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpCall, 0),
@@ -589,6 +684,7 @@ func TestCallFuncExpr(t *testing.T) {
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpClosure, 0, 0),
 				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpPop),
 				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpConstant, 1),
@@ -614,6 +710,7 @@ func TestCallFuncExpr(t *testing.T) {
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpClosure, 0, 0),
 				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpPop),
 				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpConstant, 1),
@@ -782,15 +879,17 @@ func TestClosures(t *testing.T) {
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCaptureLocal, 0),
 					code.Make(code.OpClosure, 0, 1),
 					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
 					code.Make(code.OpReturnValue),
 				},
 			},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpClosure, 1, 0),
 				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpPop),
 			},
 		},
@@ -806,22 +905,25 @@ func TestClosures(t *testing.T) {
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
-					code.Make(code.OpContext, 0),
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCaptureContext, 0),
+					code.Make(code.OpCaptureLocal, 0),
 					code.Make(code.OpClosure, 0, 2),
 					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCaptureLocal, 0),
 					code.Make(code.OpClosure, 1, 1),
 					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
 					code.Make(code.OpReturnValue),
 				},
 			},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpClosure, 2, 0),
 				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpPop),
 			},
 		},
@@ -856,18 +958,20 @@ func TestClosures(t *testing.T) {
 				[]code.Instructions{
 					code.Make(code.OpConstant, 2),
 					code.Make(code.OpSetLocal, 0),
-					code.Make(code.OpContext, 0),
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCaptureContext, 0),
+					code.Make(code.OpCaptureLocal, 0),
 					code.Make(code.OpClosure, 4, 2),
 					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
 					code.Make(code.OpConstant, 1),
 					code.Make(code.OpSetLocal, 0),
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCaptureLocal, 0),
 					code.Make(code.OpClosure, 5, 1),
 					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
 					code.Make(code.OpReturnValue),
 				},
 			},
@@ -876,11 +980,163 @@ func TestClosures(t *testing.T) {
 				code.Make(code.OpSetGlobal, 0),
 				code.Make(code.OpClosure, 6, 0),
 				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestLoops(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `while (true) { break continue }`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpConditionNotTrue, 13),
+				code.Make(code.OpJump, 13),
+				code.Make(code.OpJump, 0),
+				code.Make(code.OpJump, 0),
+			},
+		},
+		{
+			input:             `for (var i = 0; i < 10; i) { continue }`,
+			expectedConstants: []interface{}{0, 10},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpLSS),
+				code.Make(code.OpJumpConditionNotTrue, 26),
+				code.Make(code.OpJump, 19),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpJump, 6),
+			},
+		},
+		{
+			input:             `for (;;) { while (false) { break } break }`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpFalse),
+				code.Make(code.OpJumpConditionNotTrue, 10),
+				code.Make(code.OpJump, 10),
+				code.Make(code.OpJump, 0),
+				code.Make(code.OpJump, 16),
+				code.Make(code.OpJump, 0),
+			},
+		},
+		{
+			input:             `if (true) { while (false) {} }`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpConditionNotTrue, 15),
+				code.Make(code.OpFalse),
+				code.Make(code.OpJumpConditionNotTrue, 11),
+				code.Make(code.OpJump, 4),
+				code.Make(code.OpNil),
+				code.Make(code.OpJump, 16),
+				code.Make(code.OpNil),
 				code.Make(code.OpPop),
 			},
 		},
 	}
 	runCompilerTests(t, tests)
+
+	for _, input := range []string{"break", "continue", "while (true) { func f() { break } }"} {
+		err := NewCompiler().Compiler(parse(input))
+		assert.Error(t, err)
+	}
+}
+
+func TestReturnOutsideFunction(t *testing.T) {
+	for _, input := range []string{"return 1", "if (true) { return 1 }", "while (true) { return 1 }"} {
+		err := NewCompiler().Compiler(parse(input))
+		assert.EqualError(t, err, "return is not in a function", input)
+	}
+	assert.NoError(t, NewCompiler().Compiler(parse("func f() { while (true) { return 1 } }")))
+}
+
+func TestAssignStmt(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `var a = 1 a = 2`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+		{
+			input: `func f() { var a = 1 a = 2 }`,
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `func f(a) { func g() { a = 1 } }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetContext, 0),
+					code.Make(code.OpReturn),
+				},
+				[]code.Instructions{
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 1, 1),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `var a = [1] a[0] = 2`,
+			expectedConstants: []interface{}{1, 0, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSetIndex),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+
+	for _, input := range []string{"a = 1", "len = 1", "func f() { f = 1 }"} {
+		err := NewCompiler().Compiler(parse(input))
+		assert.Error(t, err)
+	}
 }
 
 func runCompilerTests(t *testing.T, tests []compilerTestCase) {
@@ -899,3 +1155,38 @@ func runCompilerTests(t *testing.T, tests []compilerTestCase) {
 		testConstants(t, test.expectedConstants, bytecode.Constants)
 	}
 }
+
+func TestPositions(t *testing.T) {
+	compiler := NewCompiler()
+	err := compiler.Compiler(parse("var a = 1\nfunc add(b) {\n  a + b\n}"))
+	assert.NoError(t, err)
+	bytecode := compiler.Bytecode()
+
+	// 0000 OpConstant 0
+	// 0003 OpSetGlobal 0
+	// 0006 OpClosure 1 0
+	// 0010 OpSetGlobal 1
+	// 0013 OpPop
+	assert.Equal(t, PosTable{
+		{Offset: 0, Pos: token.Position{Line: 1, Column: 9}},
+		{Offset: 3, Pos: token.Position{Line: 1, Column: 1}},
+		{Offset: 6, Pos: token.Position{Line: 2, Column: 1}},
+	}, bytecode.Positions)
+
+	fn, ok := bytecode.Constants[1].(*CompiledFunction)
+	assert.Equal(t, ok, true)
+	// 0000 OpGetGlobal 0
+	// 0003 OpGetLocal 0
+	// 0005 OpAdd
+	// 0006 OpReturnValue
+	assert.Equal(t, PosTable{
+		{Offset: 0, Pos: token.Position{Line: 3, Column: 3}},
+		{Offset: 3, Pos: token.Position{Line: 3, Column: 7}},
+		{Offset: 5, Pos: token.Position{Line: 3, Column: 5}},
+		{Offset: 6, Pos: token.Position{Line: 3, Column: 3}},
+	}, fn.Positions)
+
+	pos, ok := fn.Positions.Lookup(4)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, token.Position{Line: 3, Column: 7}, pos)
+}
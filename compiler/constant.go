@@ -0,0 +1,34 @@
+package compiler
+
+import (
+	"errors"
+	"math"
+
+	"github.com/songzhibin97/mini-interpreter/object"
+)
+
+// MaxConstants 常量池容量, OpConstant/OpClosure 的常量索引为 2 字节
+const MaxConstants = math.MaxUint16 + 1
+
+var ErrTooManyConstants = errors.New("too many constants: constant pool is limited to 65536 entries")
+
+// constantKey 常量去重使用的键
+type constantKey struct {
+	typ object.Type
+	i   int64
+	s   string
+}
+
+// newConstantKey 整数/浮点数与字符串常量可以去重, 函数等其他常量不参与
+func newConstantKey(obj object.Object) (constantKey, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return constantKey{typ: obj.Type(), i: obj.Value}, true
+	case *Float:
+		// 按位比较, 区分 0 与 -0
+		return constantKey{typ: obj.Type(), i: int64(math.Float64bits(obj.Value))}, true
+	case *object.Stringer:
+		return constantKey{typ: obj.Type(), s: obj.Value}, true
+	}
+	return constantKey{}, false
+}
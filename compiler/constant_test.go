@@ -0,0 +1,97 @@
+package compiler
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songzhibin97/mini-compiler/code"
+	"github.com/songzhibin97/mini-interpreter/object"
+)
+
+func TestConstantDeduplication(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `var a = 1 var b = "x" var c = 1 var d = "x"`,
+			expectedConstants: []interface{}{1, "x"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 2),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 3),
+			},
+		},
+		{
+			input: `func f() { 1 } 1`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// 浮点数与整数不合并
+			input:             `1.0 1 1.0`,
+			expectedConstants: []interface{}{1.0, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+
+	// 复用之前的常量池(REPL)
+	symbolTable := NewSymbolTable()
+	constants := []object.Object{&object.Integer{Value: 2}, &object.Stringer{Value: "a"}}
+	compiler := NewCompilerWithSymbol(symbolTable, constants)
+	assert.NoError(t, compiler.Compiler(parse(`"a" + "b" 2`)))
+	bytecode := compiler.Bytecode()
+	testConstants(t, []interface{}{2, "a", "b"}, bytecode.Constants)
+	testInstructions(t, []code.Instructions{
+		code.Make(code.OpConstant, 1),
+		code.Make(code.OpConstant, 2),
+		code.Make(code.OpAdd),
+		code.Make(code.OpPop),
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpPop),
+	}, bytecode.Instructions)
+}
+
+func TestConstantPoolLimit(t *testing.T) {
+	source := func(n int) string {
+		var b strings.Builder
+		for i := 0; i < n; i++ {
+			b.WriteString(strconv.Itoa(i) + " ")
+		}
+		return b.String()
+	}
+
+	compiler := NewCompiler()
+	assert.NoError(t, compiler.Compiler(parse(source(MaxConstants))))
+	assert.Equal(t, MaxConstants, len(compiler.Bytecode().Constants))
+
+	compiler = NewCompiler()
+	err := compiler.Compiler(parse(source(MaxConstants + 1)))
+	assert.Equal(t, ErrTooManyConstants, err)
+}
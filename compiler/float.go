@@ -0,0 +1,60 @@
+package compiler
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/songzhibin97/mini-interpreter/object"
+)
+
+// FLOAT 浮点数类型, object 包中没有对应的类型
+const FLOAT object.Type = "FLOAT"
+
+// Float 64 位浮点数, 与整数混合运算时整数提升为浮点数
+type Float struct{ Value float64 }
+
+func (f *Float) Type() object.Type { return FLOAT }
+
+// Inspect 整数值保留 ".0" 以便与整数区分, 过大或过小时使用科学计数法
+func (f *Float) Inspect() string {
+	abs := math.Abs(f.Value)
+	if abs != 0 && (abs < 1e-6 || abs >= 1e21) || math.IsNaN(f.Value) {
+		return strconv.FormatFloat(f.Value, 'g', -1, 64)
+	}
+	s := strconv.FormatFloat(f.Value, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
+
+// MapKey 整数值的浮点数与对应的整数是同一个键(1 == 1.0), -0 与 0 同样是同一个键
+func (f *Float) MapKey() object.MapKey {
+	v := f.Value
+	if v == math.Trunc(v) && v >= math.MinInt64 && v < math.MaxInt64 {
+		return (&object.Integer{Value: int64(v)}).MapKey()
+	}
+	return object.MapKey{Type: FLOAT, Value: math.Float64bits(v)}
+}
+
+// ToFloat 将整数或浮点数转换为 float64, 其他类型返回 false
+func ToFloat(obj object.Object) (float64, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value), true
+	case *Float:
+		return obj.Value, true
+	}
+	return 0, false
+}
+
+// FloatOperands 两个操作数均为数字且至少一个为浮点数时, 返回提升为 float64 的值
+func FloatOperands(left, right object.Object) (float64, float64, bool) {
+	if left.Type() != FLOAT && right.Type() != FLOAT {
+		return 0, 0, false
+	}
+	lv, lok := ToFloat(left)
+	rv, rok := ToFloat(right)
+	return lv, rv, lok && rok
+}
@@ -0,0 +1,308 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/songzhibin97/mini-compiler/ast"
+	"github.com/songzhibin97/mini-compiler/code"
+	"github.com/songzhibin97/mini-interpreter/object"
+)
+
+var (
+	ErrDivisionByZero = errors.New("division by zero")
+	ErrNegativeShift  = errors.New("negative shift count")
+)
+
+// SetConstantFolding 开启/关闭常量折叠, 默认关闭
+func (c *Compiler) SetConstantFolding(enable bool) {
+	c.folding = enable
+}
+
+// foldConstant 在编译期计算常量表达式
+// 表达式中含有非字面量时返回 ok=false, 计算出错(如除零)时返回 error
+// 计算结果必须与虚拟机运行时的语义保持一致
+// 整数溢出时不折叠, 留给运行时按虚拟机配置回绕或报错
+func foldConstant(node ast.Expr) (object.Object, bool, error) {
+	switch node := node.(type) {
+	case *ast.Integer:
+		return &object.Integer{Value: node.Value}, true, nil
+
+	case *ast.Float:
+		return &Float{Value: node.Value}, true, nil
+
+	case *ast.String:
+		return &object.Stringer{Value: node.Value}, true, nil
+
+	case *ast.Boolean:
+		return &object.Boolean{Value: node.Value}, true, nil
+
+	case *ast.PrefixExpr:
+		right, ok, err := foldConstant(node.Right)
+		if !ok || err != nil {
+			return nil, false, err
+		}
+		return foldPrefix(node.Operator, right)
+
+	case *ast.InfixExpr:
+		left, ok, err := foldConstant(node.Left)
+		if !ok || err != nil {
+			return nil, false, err
+		}
+		if node.Operator == "&&" || node.Operator == "||" {
+			return foldLogical(node.Operator, left, node.Right)
+		}
+		right, ok, err := foldConstant(node.Right)
+		if !ok || err != nil {
+			return nil, false, err
+		}
+		return foldInfix(node.Operator, left, right)
+	}
+	return nil, false, nil
+}
+
+// foldLogical 折叠 && 与 ||, 左侧能决定结果时右侧不会执行, 其中的错误也不会发生
+func foldLogical(operator string, left object.Object, rightNode ast.Expr) (object.Object, bool, error) {
+	right, ok, err := foldConstant(rightNode)
+	if isTruthy(left) == (operator == "||") {
+		if !ok && err == nil {
+			// 右侧不是常量时仍正常编译, 保留未定义变量等编译错误
+			return nil, false, nil
+		}
+		return left, true, nil
+	}
+	return right, ok, err
+}
+
+// isTruthy 与虚拟机的 isTrue 一致
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Nil:
+		return false
+	default:
+		return true
+	}
+}
+
+func foldPrefix(operator string, right object.Object) (object.Object, bool, error) {
+	switch operator {
+	case "-":
+		if f, ok := right.(*Float); ok {
+			return &Float{Value: -f.Value}, true, nil
+		}
+		v, ok := right.(*object.Integer)
+		if !ok {
+			return nil, false, fmt.Errorf("unsupported type for minus %s", right.Type())
+		}
+		if v.Value == math.MinInt64 {
+			return nil, false, nil
+		}
+		return &object.Integer{Value: -v.Value}, true, nil
+	case "^":
+		v, ok := right.(*object.Integer)
+		if !ok {
+			return nil, false, fmt.Errorf("unsupported type for bitwise not %s", right.Type())
+		}
+		return &object.Integer{Value: ^v.Value}, true, nil
+	case "!":
+		// 与 OpBang 一致: 仅 false 取反为 true
+		v, ok := right.(*object.Boolean)
+		return &object.Boolean{Value: ok && !v.Value}, true, nil
+	}
+	return nil, false, nil
+}
+
+func foldInfix(operator string, left, right object.Object) (object.Object, bool, error) {
+	if lv, rv, ok := FloatOperands(left, right); ok {
+		obj, ok, err := foldFloatInfix(operator, lv, rv)
+		if ok || err != nil {
+			return obj, ok, err
+		}
+	}
+	switch left := left.(type) {
+	case *object.Integer:
+		if right, ok := right.(*object.Integer); ok {
+			return foldIntegerInfix(operator, left.Value, right.Value)
+		}
+	case *object.Stringer:
+		if right, ok := right.(*object.Stringer); ok {
+			return foldStringInfix(operator, left.Value, right.Value)
+		}
+	case *object.Boolean:
+		if right, ok := right.(*object.Boolean); ok {
+			switch operator {
+			case "==":
+				return &object.Boolean{Value: left.Value == right.Value}, true, nil
+			case "!=":
+				return &object.Boolean{Value: left.Value != right.Value}, true, nil
+			}
+		}
+	}
+
+	switch operator {
+	case "+", "-", "*", "/", "%", "&", "|", "^", "<<", ">>":
+		return nil, false, fmt.Errorf("unsupported types for operation %s %s", left.Type(), right.Type())
+	}
+	return nil, false, nil
+}
+
+func foldIntegerInfix(operator string, lv, rv int64) (object.Object, bool, error) {
+	switch operator {
+	case "+":
+		if (lv+rv > lv) != (rv > 0) {
+			return nil, false, nil
+		}
+		return &object.Integer{Value: lv + rv}, true, nil
+	case "-":
+		if (lv-rv < lv) != (rv > 0) {
+			return nil, false, nil
+		}
+		return &object.Integer{Value: lv - rv}, true, nil
+	case "*":
+		if lv != 0 && (lv*rv/lv != rv || (lv == -1 && rv == math.MinInt64)) {
+			return nil, false, nil
+		}
+		return &object.Integer{Value: lv * rv}, true, nil
+	case "/":
+		if rv == 0 {
+			return nil, false, ErrDivisionByZero
+		}
+		if lv == math.MinInt64 && rv == -1 {
+			return nil, false, nil
+		}
+		return &object.Integer{Value: lv / rv}, true, nil
+	case "%":
+		if rv == 0 {
+			return nil, false, ErrDivisionByZero
+		}
+		return &object.Integer{Value: lv % rv}, true, nil
+	case "&":
+		return &object.Integer{Value: lv & rv}, true, nil
+	case "|":
+		return &object.Integer{Value: lv | rv}, true, nil
+	case "^":
+		return &object.Integer{Value: lv ^ rv}, true, nil
+	case "<<":
+		if rv < 0 {
+			return nil, false, ErrNegativeShift
+		}
+		return &object.Integer{Value: lv << uint64(rv)}, true, nil
+	case ">>":
+		if rv < 0 {
+			return nil, false, ErrNegativeShift
+		}
+		return &object.Integer{Value: lv >> uint64(rv)}, true, nil
+	case "==":
+		return &object.Boolean{Value: lv == rv}, true, nil
+	case "!=":
+		return &object.Boolean{Value: lv != rv}, true, nil
+	case ">":
+		return &object.Boolean{Value: lv > rv}, true, nil
+	case "<":
+		return &object.Boolean{Value: lv < rv}, true, nil
+	case "<=":
+		return &object.Boolean{Value: lv <= rv}, true, nil
+	case ">=":
+		return &object.Boolean{Value: lv >= rv}, true, nil
+	}
+	return nil, false, nil
+}
+
+// foldFloatInfix 浮点数(或与整数混合)支持四则运算, 取模与比较
+// 与虚拟机一致遵循 IEEE 754, 除零得到 ±Inf 或 NaN
+func foldFloatInfix(operator string, lv, rv float64) (object.Object, bool, error) {
+	switch operator {
+	case "+":
+		return &Float{Value: lv + rv}, true, nil
+	case "-":
+		return &Float{Value: lv - rv}, true, nil
+	case "*":
+		return &Float{Value: lv * rv}, true, nil
+	case "/":
+		return &Float{Value: lv / rv}, true, nil
+	case "%":
+		return &Float{Value: math.Mod(lv, rv)}, true, nil
+	case "==":
+		return &object.Boolean{Value: lv == rv}, true, nil
+	case "!=":
+		return &object.Boolean{Value: lv != rv}, true, nil
+	case ">":
+		return &object.Boolean{Value: lv > rv}, true, nil
+	case "<":
+		return &object.Boolean{Value: lv < rv}, true, nil
+	case "<=":
+		return &object.Boolean{Value: lv <= rv}, true, nil
+	case ">=":
+		return &object.Boolean{Value: lv >= rv}, true, nil
+	}
+	return nil, false, nil
+}
+
+func foldStringInfix(operator string, lv, rv string) (object.Object, bool, error) {
+	switch operator {
+	case "+":
+		return &object.Stringer{Value: lv + rv}, true, nil
+	case "==":
+		return &object.Boolean{Value: lv == rv}, true, nil
+	case "!=":
+		return &object.Boolean{Value: lv != rv}, true, nil
+	case ">":
+		return &object.Boolean{Value: lv > rv}, true, nil
+	case "<":
+		return &object.Boolean{Value: lv < rv}, true, nil
+	case "<=":
+		return &object.Boolean{Value: lv <= rv}, true, nil
+	case ">=":
+		return &object.Boolean{Value: lv >= rv}, true, nil
+	}
+	return nil, false, nil
+}
+
+// emitFolded 发出折叠后的常量
+func (c *Compiler) emitFolded(obj object.Object) error {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		if obj.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	default:
+		idx, err := c.addConstant(obj)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpConstant, idx)
+	}
+	return nil
+}
+
+// compileFoldedIf 条件为常量时只编译会执行的分支
+func (c *Compiler) compileFoldedIf(node *ast.IfExpr, cond object.Object) error {
+	branch := node.Alternative
+	if b, ok := cond.(*object.Boolean); !ok || b.Value {
+		branch = node.Consequence
+	}
+	if branch == nil {
+		c.emit(code.OpNil)
+		return nil
+	}
+
+	start := len(c.curInstructions())
+	err := c.Compiler(branch)
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(c.curInstructions()) == start:
+		c.emit(code.OpNil)
+	case c.lastInstructionIs(code.OpPop):
+		c.removeLastPop()
+	case !c.lastInstructionIs(code.OpReturnValue):
+		c.emit(code.OpNil)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package compiler
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songzhibin97/mini-compiler/code"
+)
+
+func TestConstantFolding(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `1 + 2 * 3`,
+			expectedConstants: []interface{}{7},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `-(1 - 3) / 2`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `"mini" + "-" + "compiler"`,
+			expectedConstants: []interface{}{"mini-compiler"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `1 < 2 == !false`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `var a = 1 a + 2 * 3`,
+			expectedConstants: []interface{}{1, 6},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `("a" < "b") == (2 >= 2)`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `(1 && 2) || (false && 1 / 0)`,
+			expectedConstants: []interface{}{2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `var a = 1 false && a`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpFalse),
+				code.Make(code.OpJumpNotTrueOrPop, 13),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `(7 % 3 | 4) ^ ^1 << 2 >> 1 & 6`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// 溢出时不折叠, 由运行时决定回绕或报错
+			input:             `(9223372036854775806 + 1) + 1`,
+			expectedConstants: []interface{}{9223372036854775807, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `-1.5 * 2 + 1 / 4.0`,
+			expectedConstants: []interface{}{-2.75},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// IEEE 754: 浮点数除零不是错误
+			input:             `[1.0 / 0, -1 / 0.0, 5 % 2.0, -5.5 % 2]`,
+			expectedConstants: []interface{}{math.Inf(1), math.Inf(-1), 1.0, -1.5},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpArray, 4),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `(1 == 1.0) && (0.5 < 1) && (2 >= 2.5)`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpFalse),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `("a" + "b" == "ab") != ("a" != "a")`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `if (1 > 2) { 10 } else { 20 }`,
+			expectedConstants: []interface{}{20},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `if (false) { 10 } if (true) {}`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpNil),
+				code.Make(code.OpPop),
+				code.Make(code.OpNil),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		compiler := NewCompiler()
+		compiler.SetConstantFolding(true)
+		err := compiler.Compiler(parse(test.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		bytecode := compiler.Bytecode()
+		testInstructions(t, test.expectedInstructions, bytecode.Instructions)
+		testConstants(t, test.expectedConstants, bytecode.Constants)
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{input: `1 / 0`, expected: "division by zero"},
+		{input: `var a = 2 * (3 / (1 - 1))`, expected: "division by zero"},
+		{input: `if (1 / 0) { 1 }`, expected: "division by zero"},
+		{input: `1 + "a"`, expected: "unsupported types for operation INT STRING"},
+		{input: `-"a"`, expected: "unsupported type for minus STRING"},
+		{input: `5 % (2 - 2)`, expected: "division by zero"},
+		{input: `1 << -1`, expected: "negative shift count"},
+		{input: `8 >> (1 - 2)`, expected: "negative shift count"},
+		{input: `"a" % 2`, expected: "unsupported types for operation STRING INT"},
+		{input: `^true`, expected: "unsupported type for bitwise not BOOL"},
+		{input: `1.5 << 1`, expected: "unsupported types for operation FLOAT INT"},
+		{input: `^1.5`, expected: "unsupported type for bitwise not FLOAT"},
+		{input: `1.5 + "a"`, expected: "unsupported types for operation FLOAT STRING"},
+		{input: `true && 1 / 0`, expected: "division by zero"},
+		{input: `true || b`, expected: "undefined variable b"},
+	}
+	for _, test := range errTests {
+		compiler := NewCompiler()
+		compiler.SetConstantFolding(true)
+		err := compiler.Compiler(parse(test.input))
+		assert.EqualError(t, err, test.expected)
+	}
+}
@@ -9,19 +9,21 @@ import (
 )
 
 type CompiledFunction struct {
+	Name          string // 声明的函数名
 	Instructions  code.Instructions
 	NumLocals     int
 	NumParameters int
+	Positions     PosTable // 指令对应的源码位置
 }
 
 func (cf *CompiledFunction) Type() object.Type { return "COMPILED_FUNCTION" }
 func (cf *CompiledFunction) Inspect() string {
-	return fmt.Sprintf("CompiledFunction[%p]", cf)
+	return fmt.Sprintf("CompiledFunction[%s %p]", cf.Name, cf)
 }
 
 type Closure struct {
 	Fn  *CompiledFunction
-	Ctx []object.Object // 上下文环境
+	Ctx []*Upvalue // 上下文环境
 }
 
 func (c *Closure) Type() object.Type { return "CLOSURE" }
@@ -29,52 +31,27 @@ func (c *Closure) Inspect() string {
 	return fmt.Sprintf("Closure[%p]", c)
 }
 
-type Builtin struct {
-	Fn   *object.Builtin
-	Name string
+// Upvalue 闭包捕获的变量
+// 外层函数返回前 Ref 指向栈上的槽位, 同一槽位的所有闭包共享读写; 返回后关闭, Ref 指向 Closed
+type Upvalue struct {
+	Ref    *object.Object
+	Closed object.Object
 }
 
-var builtins = []*Builtin{
-	{
-		Fn: &object.Builtin{Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return &object.Error{Error: fmt.Sprintf("wrong number of arguments. got=%d, want=1", len(args))}
-			}
-			switch arg := args[0].(type) {
-			case *object.Map:
-				return &object.Integer{Value: int64(len(arg.Elements))}
-			case *object.Array:
-				return &object.Integer{Value: int64(len(arg.Elements))}
-			case *object.Stringer:
-				return &object.Integer{Value: int64(len(arg.Value))}
-			default:
-				return &object.Error{Error: fmt.Sprintf("argument to `len` not supported, got %s", args[0].Type())}
-			}
-		}},
-		Name: "len",
-	},
-	{
-		Fn: &object.Builtin{Fn: func(args ...object.Object) object.Object {
-			for _, arg := range args {
-				fmt.Println(arg.Inspect())
-			}
-			return &object.Nil{}
-		}},
-		Name: "print",
-	},
+func (u *Upvalue) Type() object.Type { return "UPVALUE" }
+func (u *Upvalue) Inspect() string {
+	return fmt.Sprintf("Upvalue[%p]", u)
 }
 
-func IterBuiltin() []string {
-	res := []string{}
-	for _, builtin := range builtins {
-		res = append(res, builtin.Name)
-	}
-	return res
+// Close 将栈上的值拷贝到 upvalue 内部, 此后不再引用栈
+func (u *Upvalue) Close() {
+	u.Closed = *u.Ref
+	u.Ref = &u.Closed
 }
 
-func GetBuiltinByIndex(idx int) *object.Builtin {
-	if idx < 0 || idx > len(builtins) {
-		return nil
-	}
-	return builtins[idx].Fn
+// NewClosedUpvalue 创建一个已关闭的 upvalue
+func NewClosedUpvalue(o object.Object) *Upvalue {
+	u := &Upvalue{Closed: o}
+	u.Ref = &u.Closed
+	return u
 }
@@ -0,0 +1,402 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/songzhibin97/mini-interpreter/object"
+)
+
+// maxConvertDepth 转换嵌套数组/字典/结构体的最大深度, 防止循环引用导致无限递归
+const maxConvertDepth = 64
+
+var errTooDeep = errors.New("value is nested too deeply")
+
+var (
+	objectType  = reflect.TypeOf((*object.Object)(nil)).Elem()
+	runtimeType = reflect.TypeOf((*Runtime)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// ToObject 将 Go 值转换为对象
+//   - 整数 -> INT, 浮点数 -> FLOAT, string -> STRING, bool -> BOOL, nil -> NIL
+//   - 切片/数组 -> ARRAY, map -> MAP
+//   - 结构体 -> 以导出字段名为键的 MAP, 可通过 `mini:"name"` 修改键名, `mini:"-"` 忽略字段
+//   - 指针取其指向的值, object.Object 原样返回
+func ToObject(v interface{}) (object.Object, error) {
+	return toObject(reflect.ValueOf(v), 0)
+}
+
+func toObject(v reflect.Value, depth int) (object.Object, error) {
+	if depth > maxConvertDepth {
+		return nil, errTooDeep
+	}
+	if !v.IsValid() {
+		return Nil, nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			return Nil, nil
+		}
+	}
+	if v.CanInterface() {
+		if obj, ok := v.Interface().(object.Object); ok {
+			return obj, nil
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return True, nil
+		}
+		return False, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("value %d overflows %s", v.Uint(), object.INT)
+		}
+		return &object.Integer{Value: int64(v.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Float{Value: v.Float()}, nil
+	case reflect.String:
+		return &object.Stringer{Value: v.String()}, nil
+	case reflect.Slice, reflect.Array:
+		elems := make([]object.Object, v.Len())
+		for i := range elems {
+			elem, err := toObject(v.Index(i), depth+1)
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %w", i, err)
+			}
+			elems[i] = elem
+		}
+		return &object.Array{Elements: elems}, nil
+	case reflect.Map:
+		mp := make(map[object.MapKey]object.HashValue, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := toObject(iter.Key(), depth+1)
+			if err != nil {
+				return nil, fmt.Errorf("key %v: %w", iter.Key(), err)
+			}
+			hashAble, ok := key.(object.HashAble)
+			if !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+			val, err := toObject(iter.Value(), depth+1)
+			if err != nil {
+				return nil, fmt.Errorf("key %v: %w", iter.Key(), err)
+			}
+			mp[hashAble.MapKey()] = object.HashValue{Key: key, Value: val}
+		}
+		return &object.Map{Elements: mp}, nil
+	case reflect.Struct:
+		mp := make(map[object.MapKey]object.HashValue, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			name, ok := fieldName(v.Type().Field(i))
+			if !ok {
+				continue
+			}
+			val, err := toObject(v.Field(i), depth+1)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", name, err)
+			}
+			key := &object.Stringer{Value: name}
+			mp[key.MapKey()] = object.HashValue{Key: key, Value: val}
+		}
+		return &object.Map{Elements: mp}, nil
+	case reflect.Ptr, reflect.Interface:
+		return toObject(v.Elem(), depth+1)
+	default:
+		return nil, fmt.Errorf("unsupported type %s", v.Type())
+	}
+}
+
+// FromObject 将对象转换为 target 指向的 Go 值, 规则与 ToObject 相反
+// target 为 interface{} 时 INT/FLOAT/STRING/BOOL/ARRAY/MAP 分别转换为 int64/float64/string/bool/[]interface{}/map[interface{}]interface{}
+// target 为浮点数时也接受 INT
+// target 为 object.Object 或具体的对象类型(如 *compiler.Closure)时直接赋值
+func FromObject(obj object.Object, target interface{}) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("target must be a non-nil pointer, got %T", target)
+	}
+	return fromObject(obj, v.Elem(), 0)
+}
+
+func fromObject(obj object.Object, v reflect.Value, depth int) error {
+	if depth > maxConvertDepth {
+		return errTooDeep
+	}
+	if obj == nil {
+		obj = Nil
+	}
+	t := v.Type()
+
+	if reflect.TypeOf(obj) == t || t.Kind() == reflect.Interface && t.NumMethod() > 0 {
+		if !reflect.TypeOf(obj).AssignableTo(t) {
+			return mismatch(obj, t)
+		}
+		v.Set(reflect.ValueOf(obj))
+		return nil
+	}
+	if _, ok := obj.(*object.Nil); ok {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		return mismatch(obj, t)
+	}
+	if t.Implements(objectType) {
+		// 其他对象类型
+		return mismatch(obj, t)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		b, ok := obj.(*object.Boolean)
+		if !ok {
+			return mismatch(obj, t)
+		}
+		v.SetBool(b.Value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := obj.(*object.Integer)
+		if !ok {
+			return mismatch(obj, t)
+		}
+		if v.OverflowInt(i.Value) {
+			return fmt.Errorf("value %d overflows %s", i.Value, t)
+		}
+		v.SetInt(i.Value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, ok := obj.(*object.Integer)
+		if !ok {
+			return mismatch(obj, t)
+		}
+		if i.Value < 0 || v.OverflowUint(uint64(i.Value)) {
+			return fmt.Errorf("value %d overflows %s", i.Value, t)
+		}
+		v.SetUint(uint64(i.Value))
+	case reflect.Float32, reflect.Float64:
+		// 整数可以直接转换为浮点数
+		f, ok := ToFloat(obj)
+		if !ok {
+			return mismatch(obj, t)
+		}
+		v.SetFloat(f)
+	case reflect.String:
+		s, ok := obj.(*object.Stringer)
+		if !ok {
+			return mismatch(obj, t)
+		}
+		v.SetString(s.Value)
+	case reflect.Slice, reflect.Array:
+		arr, ok := obj.(*object.Array)
+		if !ok {
+			return mismatch(obj, t)
+		}
+		elems := v
+		if t.Kind() == reflect.Slice {
+			elems = reflect.MakeSlice(t, len(arr.Elements), len(arr.Elements))
+		} else if t.Len() != len(arr.Elements) {
+			return fmt.Errorf("cannot convert %s of length %d to %s", obj.Type(), len(arr.Elements), t)
+		}
+		for i, elem := range arr.Elements {
+			err := fromObject(elem, elems.Index(i), depth+1)
+			if err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+		v.Set(elems)
+	case reflect.Map:
+		mp, ok := obj.(*object.Map)
+		if !ok {
+			return mismatch(obj, t)
+		}
+		m := reflect.MakeMapWithSize(t, len(mp.Elements))
+		for _, pair := range mp.Elements {
+			key := reflect.New(t.Key()).Elem()
+			err := fromObject(pair.Key, key, depth+1)
+			if err != nil {
+				return fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+			}
+			val := reflect.New(t.Elem()).Elem()
+			err = fromObject(pair.Value, val, depth+1)
+			if err != nil {
+				return fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+			}
+			m.SetMapIndex(key, val)
+		}
+		v.Set(m)
+	case reflect.Struct:
+		mp, ok := obj.(*object.Map)
+		if !ok {
+			return mismatch(obj, t)
+		}
+		for i := 0; i < t.NumField(); i++ {
+			name, ok := fieldName(t.Field(i))
+			if !ok {
+				continue
+			}
+			pair, ok := mp.Elements[(&object.Stringer{Value: name}).MapKey()]
+			if !ok {
+				continue
+			}
+			err := fromObject(pair.Value, v.Field(i), depth+1)
+			if err != nil {
+				return fmt.Errorf("field %s: %w", name, err)
+			}
+		}
+	case reflect.Ptr:
+		p := reflect.New(t.Elem())
+		err := fromObject(obj, p.Elem(), depth+1)
+		if err != nil {
+			return err
+		}
+		v.Set(p)
+	case reflect.Interface:
+		val := reflect.New(naturalType(obj)).Elem()
+		err := fromObject(obj, val, depth+1)
+		if err != nil {
+			return err
+		}
+		v.Set(val)
+	default:
+		return fmt.Errorf("unsupported type %s", t)
+	}
+	return nil
+}
+
+func mismatch(obj object.Object, t reflect.Type) error {
+	return fmt.Errorf("cannot convert %s to %s", obj.Type(), t)
+}
+
+// naturalType 转换到 interface{} 时对象对应的 Go 类型
+func naturalType(obj object.Object) reflect.Type {
+	switch obj.(type) {
+	case *object.Integer:
+		return reflect.TypeOf(int64(0))
+	case *Float:
+		return reflect.TypeOf(float64(0))
+	case *object.Stringer:
+		return reflect.TypeOf("")
+	case *object.Boolean:
+		return reflect.TypeOf(false)
+	case *object.Array:
+		return reflect.TypeOf([]interface{}(nil))
+	case *object.Map:
+		return reflect.TypeOf(map[interface{}]interface{}(nil))
+	default:
+		return reflect.TypeOf(obj)
+	}
+}
+
+// fieldName 结构体字段对应的字典键, 未导出或 tag 为 "-" 的字段返回 false
+func fieldName(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" {
+		return "", false
+	}
+	switch tag := f.Tag.Get("mini"); tag {
+	case "-":
+		return "", false
+	case "":
+		return f.Name, true
+	default:
+		return tag, true
+	}
+}
+
+// WrapFunc 通过反射将普通 Go 函数包装为内置函数, 返回包装后的函数与参数数量
+//   - 参数与返回值按 FromObject/ToObject 的规则转换
+//   - 第一个参数为 Runtime 时传入虚拟机, 不计入参数数量
+//   - 最后一个返回值为 error 且不为 nil 时终止虚拟机, panic 同样转换为错误
+//   - 除 error 外最多一个返回值, 没有时返回 nil
+//
+// 例如 func(s string, n int64) (string, error)
+func WrapFunc(name string, fn interface{}) (BuiltinFunction, int, error) {
+	fv := reflect.ValueOf(fn)
+	if fv.Kind() != reflect.Func || fv.IsNil() {
+		return nil, 0, fmt.Errorf("builtin %s: expected a function, got %T", name, fn)
+	}
+	ft := fv.Type()
+
+	offset := 0 // 第一个脚本参数在 Go 函数参数中的下标
+	if ft.NumIn() > 0 && ft.In(0) == runtimeType {
+		offset = 1
+	}
+	params := ft.NumIn() - offset
+	results := ft.NumOut()
+	withError := results > 0 && ft.Out(results-1) == errorType
+	if withError {
+		results--
+	}
+	if results > 1 {
+		return nil, 0, fmt.Errorf("builtin %s: too many results, want at most one value and an error", name)
+	}
+
+	arity := params
+	if ft.IsVariadic() {
+		arity = Variadic
+	}
+	wrapped := func(rt Runtime, args ...object.Object) (object.Object, error) {
+		if ft.IsVariadic() && len(args) < params-1 {
+			return nil, fmt.Errorf("wrong number of arguments to %s: want at least %d, got %d", name, params-1, len(args))
+		}
+		if !ft.IsVariadic() && len(args) != params {
+			return nil, fmt.Errorf("wrong number of arguments to %s: want=%d, got=%d", name, params, len(args))
+		}
+
+		in := make([]reflect.Value, 0, offset+len(args))
+		if offset == 1 {
+			in = append(in, reflect.ValueOf(&rt).Elem())
+		}
+		for i, arg := range args {
+			var t reflect.Type
+			if ft.IsVariadic() && i >= params-1 {
+				t = ft.In(ft.NumIn() - 1).Elem()
+			} else {
+				t = ft.In(offset + i)
+			}
+			v := reflect.New(t).Elem()
+			err := fromObject(arg, v, 0)
+			if err != nil {
+				return nil, fmt.Errorf("argument %d to %s: %w", i+1, name, err)
+			}
+			in = append(in, v)
+		}
+
+		out, err := callFunc(name, fv, in)
+		if err != nil {
+			return nil, err
+		}
+		if withError {
+			if err := out[len(out)-1]; !err.IsNil() {
+				return nil, err.Interface().(error)
+			}
+		}
+		if results == 0 {
+			return nil, nil
+		}
+		obj, err := toObject(out[0], 0)
+		if err != nil {
+			return nil, fmt.Errorf("result of %s: %w", name, err)
+		}
+		return obj, nil
+	}
+	return wrapped, arity, nil
+}
+
+// callFunc 调用 Go 函数, 其中的 panic 转换为错误返回, 终止虚拟机而不是宿主进程
+func callFunc(name string, fv reflect.Value, in []reflect.Value) (out []reflect.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("builtin %s panicked: %v", name, r)
+		}
+	}()
+	return fv.Call(in), nil
+}
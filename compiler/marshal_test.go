@@ -0,0 +1,287 @@
+package compiler
+
+import (
+	"errors"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songzhibin97/mini-interpreter/object"
+)
+
+type point struct {
+	X      int
+	Y      int    `mini:"y"`
+	Label  string `mini:"-"`
+	hidden int
+}
+
+func TestToObject(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		expected string // Inspect
+	}{
+		{input: nil, expected: "nil"},
+		{input: 1, expected: "1"},
+		{input: uint8(255), expected: "255"},
+		{input: 1.5, expected: "1.5"},
+		{input: float32(2), expected: "2.0"},
+		{input: "s", expected: "s"},
+		{input: true, expected: "true"},
+		{input: []int{1, 2}, expected: "[1, 2]"},
+		{input: [2]string{"a", "b"}, expected: "[a, b]"},
+		{input: []int(nil), expected: "nil"},
+		{input: map[string]int{"a": 1}, expected: "{a:1}"},
+		{input: &point{X: 1, Y: 2, Label: "p", hidden: 3}, expected: "{X:1, y:2}"},
+		{input: (*point)(nil), expected: "nil"},
+		{input: &object.Integer{Value: 3}, expected: "3"},
+		{input: []interface{}{1, "a", nil}, expected: "[1, a, nil]"},
+	}
+	for _, test := range tests {
+		obj, err := ToObject(test.input)
+		assert.NoError(t, err)
+		if m, ok := obj.(*object.Map); ok && len(m.Elements) > 1 {
+			// map 遍历无序, 只比较长度
+			assert.Equal(t, len(test.expected), len(obj.Inspect()))
+			continue
+		}
+		assert.Equal(t, test.expected, obj.Inspect())
+	}
+
+	b, _ := ToObject(true)
+	assert.True(t, b == True)
+
+	errTests := []struct {
+		input interface{}
+		err   string
+	}{
+		{input: uint64(math.MaxUint64), err: "value 18446744073709551615 overflows INT"},
+		{input: 1i, err: "unsupported type complex128"},
+		{input: []interface{}{1, func() {}}, err: "element 1: unsupported type func()"},
+		{input: map[string]chan int{"c": nil}, err: "key c: unsupported type chan int"},
+		{input: map[bool]int{}, err: ""},
+	}
+	for _, test := range errTests {
+		_, err := ToObject(test.input)
+		if test.err == "" {
+			assert.NoError(t, err)
+			continue
+		}
+		assert.EqualError(t, err, test.err)
+	}
+
+	// 循环引用
+	cyclic := []interface{}{nil}
+	cyclic[0] = cyclic
+	_, err := ToObject(cyclic)
+	assert.True(t, errors.Is(err, errTooDeep))
+}
+
+func TestFromObject(t *testing.T) {
+	arr := &object.Array{Elements: []object.Object{&object.Integer{Value: 1}, &object.Integer{Value: 2}}}
+	mp, _ := ToObject(map[string]interface{}{"X": 1, "y": 2, "Label": "p", "z": 3})
+
+	var i8 int8
+	assert.NoError(t, FromObject(&object.Integer{Value: 127}, &i8))
+	assert.Equal(t, int8(127), i8)
+	assert.EqualError(t, FromObject(&object.Integer{Value: 128}, &i8), "value 128 overflows int8")
+
+	var u uint
+	assert.EqualError(t, FromObject(&object.Integer{Value: -1}, &u), "value -1 overflows uint")
+
+	var s string
+	assert.EqualError(t, FromObject(&object.Integer{Value: 1}, &s), "cannot convert INT to string")
+
+	var f float64
+	assert.NoError(t, FromObject(&Float{Value: 1.5}, &f))
+	assert.Equal(t, 1.5, f)
+	assert.NoError(t, FromObject(&object.Integer{Value: 2}, &f))
+	assert.Equal(t, 2.0, f)
+	assert.EqualError(t, FromObject(&Float{Value: 1.5}, &i8), "cannot convert FLOAT to int8")
+
+	var ints []int
+	assert.NoError(t, FromObject(arr, &ints))
+	assert.Equal(t, []int{1, 2}, ints)
+	var strs []string
+	assert.EqualError(t, FromObject(arr, &strs), "element 0: cannot convert INT to string")
+	var fixed [3]int
+	assert.EqualError(t, FromObject(arr, &fixed), "cannot convert ARRAY of length 2 to [3]int")
+
+	var p point
+	assert.NoError(t, FromObject(mp, &p))
+	assert.Equal(t, point{X: 1, Y: 2}, p)
+	var pp *point
+	assert.NoError(t, FromObject(mp, &pp))
+	assert.Equal(t, &point{X: 1, Y: 2}, pp)
+	assert.NoError(t, FromObject(Nil, &pp))
+	assert.Nil(t, pp)
+
+	var m map[string]int
+	assert.EqualError(t, FromObject(mp, &m), "key Label: cannot convert STRING to int")
+	counts, _ := ToObject(map[string]int{"a": 1, "b": 2})
+	assert.NoError(t, FromObject(counts, &m))
+	assert.Equal(t, map[string]int{"a": 1, "b": 2}, m)
+
+	var any interface{}
+	assert.NoError(t, FromObject(arr, &any))
+	assert.Equal(t, []interface{}{int64(1), int64(2)}, any)
+	assert.NoError(t, FromObject(&Float{Value: 0.5}, &any))
+	assert.Equal(t, 0.5, any)
+
+	var obj object.Object
+	assert.NoError(t, FromObject(arr, &obj))
+	assert.Equal(t, arr, obj)
+	var array *object.Array
+	assert.NoError(t, FromObject(arr, &array))
+	assert.Equal(t, arr, array)
+	var closure *Closure
+	assert.EqualError(t, FromObject(arr, &closure), "cannot convert ARRAY to *compiler.Closure")
+
+	assert.Error(t, FromObject(arr, ints))
+
+	// 循环引用
+	cyclic := &object.Array{Elements: []object.Object{nil}}
+	cyclic.Elements[0] = cyclic
+	assert.True(t, errors.Is(FromObject(cyclic, &any), errTooDeep))
+}
+
+type fakeRuntime struct{}
+
+func (fakeRuntime) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	return &object.Stringer{Value: "called"}, nil
+}
+func (fakeRuntime) Stdin() io.Reader  { return os.Stdin }
+func (fakeRuntime) Stdout() io.Writer { return os.Stdout }
+func (fakeRuntime) Stderr() io.Writer { return os.Stderr }
+
+func TestWrapFunc(t *testing.T) {
+	tests := []struct {
+		fn       interface{}
+		args     []object.Object
+		arity    int
+		expected string // Inspect
+		err      string
+	}{
+		{
+			fn:       strings.Repeat,
+			args:     []object.Object{&object.Stringer{Value: "ab"}, &object.Integer{Value: 2}},
+			arity:    2,
+			expected: "abab",
+		},
+		{
+			fn:    strings.Repeat,
+			args:  []object.Object{&object.Integer{Value: 2}, &object.Integer{Value: 2}},
+			arity: 2,
+			err:   "argument 1 to f: cannot convert INT to string",
+		},
+		{
+			fn:    strings.Repeat,
+			args:  []object.Object{&object.Stringer{Value: "ab"}},
+			arity: 2,
+			err:   "wrong number of arguments to f: want=2, got=1",
+		},
+		{
+			fn: func(prefix string, nums ...int) string {
+				return prefix + strings.Repeat("+", len(nums))
+			},
+			args:     []object.Object{&object.Stringer{Value: "n"}, &object.Integer{Value: 1}, &object.Integer{Value: 2}},
+			arity:    Variadic,
+			expected: "n++",
+		},
+		{
+			fn:    func(prefix string, nums ...int) {},
+			args:  []object.Object{},
+			arity: Variadic,
+			err:   "wrong number of arguments to f: want at least 1, got 0",
+		},
+		{
+			fn: func(n int64) (int64, error) {
+				if n < 0 {
+					return 0, errors.New("negative")
+				}
+				return n, nil
+			},
+			args:  []object.Object{&object.Integer{Value: -1}},
+			arity: 1,
+			err:   "negative",
+		},
+		{
+			fn:       func() {},
+			arity:    0,
+			expected: "nil",
+		},
+		{
+			fn:       math.Sqrt,
+			args:     []object.Object{&object.Integer{Value: 4}},
+			arity:    1,
+			expected: "2.0",
+		},
+		{
+			fn:       func() point { return point{X: 1} },
+			arity:    0,
+			expected: "{X:1, y:0}",
+		},
+		{
+			fn:    func() complex128 { return 1 },
+			arity: 0,
+			err:   "result of f: unsupported type complex128",
+		},
+		{
+			fn: func(rt Runtime, fn object.Object) (object.Object, error) {
+				return rt.Call(fn)
+			},
+			args:     []object.Object{Nil},
+			arity:    1,
+			expected: "called",
+		},
+		{
+			fn: func(k string) {
+				var m map[string]int
+				m[k] = 1
+			},
+			args:  []object.Object{&object.Stringer{Value: "a"}},
+			arity: 1,
+			err:   "builtin f panicked: assignment to entry in nil map",
+		},
+		{
+			fn:    func(s []int64) int64 { return s[len(s)] },
+			args:  []object.Object{&object.Array{}},
+			arity: 1,
+			err:   "builtin f panicked: runtime error: index out of range [0] with length 0",
+		},
+	}
+	for _, test := range tests {
+		fn, arity, err := WrapFunc("f", test.fn)
+		assert.NoError(t, err)
+		assert.Equal(t, test.arity, arity)
+		result, err := fn(fakeRuntime{}, test.args...)
+		if test.err != "" {
+			assert.EqualError(t, err, test.err)
+			continue
+		}
+		assert.NoError(t, err)
+		if result == nil {
+			result = Nil
+		}
+		if _, ok := result.(*object.Map); ok {
+			assert.Equal(t, len(test.expected), len(result.Inspect()))
+			continue
+		}
+		assert.Equal(t, test.expected, result.Inspect())
+	}
+
+	_, _, err := WrapFunc("f", 1)
+	assert.EqualError(t, err, "builtin f: expected a function, got int")
+	_, _, err = WrapFunc("f", func() (int, int) { return 0, 0 })
+	assert.Error(t, err)
+
+	builtins := NewBuiltins()
+	assert.NoError(t, builtins.RegisterFunc("upper", strings.ToUpper))
+	upper, ok := builtins.Lookup("upper")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, 1, upper.Arity)
+}
@@ -0,0 +1,83 @@
+package compiler
+
+import (
+	"github.com/songzhibin97/mini-interpreter/object"
+)
+
+// 虚拟机中的布尔值与 nil 均为单例, 按指针比较
+var (
+	True  = &object.Boolean{Value: true}
+	False = &object.Boolean{Value: false}
+	Nil   = &object.Nil{}
+)
+
+// Equal 按值比较两个对象, 用于 OpEQL/OpNEQ
+//   - 整数/浮点数/字符串/布尔按值比较, 整数与浮点数比较时提升为浮点数
+//   - 数组逐个比较元素, 字典比较键集合及对应的值
+//   - 类型不同时不相等, 函数等其他对象按引用比较
+func Equal(left, right object.Object) bool {
+	return equal(left, right, map[visitedPair]bool{})
+}
+
+// visitedPair 正在比较的一对数组/字典, 防止循环引用导致无限递归
+type visitedPair struct {
+	left, right object.Object
+}
+
+func equal(left, right object.Object, visited map[visitedPair]bool) bool {
+	// 浮点数先于引用比较, NaN 与自身也不相等
+	if lv, rv, ok := FloatOperands(left, right); ok {
+		return lv == rv
+	}
+	if left == right {
+		return true
+	}
+	if left.Type() != right.Type() {
+		return false
+	}
+	switch l := left.(type) {
+	case *object.Integer:
+		return l.Value == right.(*object.Integer).Value
+	case *object.Stringer:
+		return l.Value == right.(*object.Stringer).Value
+	case *object.Boolean:
+		return l.Value == right.(*object.Boolean).Value
+	case *object.Nil:
+		return true
+	case *object.Array:
+		r := right.(*object.Array)
+		if len(l.Elements) != len(r.Elements) {
+			return false
+		}
+		pair := visitedPair{left: left, right: right}
+		if visited[pair] {
+			// 已在比较中, 由外层的比较决定结果
+			return true
+		}
+		visited[pair] = true
+		for i := range l.Elements {
+			if !equal(l.Elements[i], r.Elements[i], visited) {
+				return false
+			}
+		}
+		return true
+	case *object.Map:
+		r := right.(*object.Map)
+		if len(l.Elements) != len(r.Elements) {
+			return false
+		}
+		pair := visitedPair{left: left, right: right}
+		if visited[pair] {
+			return true
+		}
+		visited[pair] = true
+		for key, lp := range l.Elements {
+			rp, ok := r.Elements[key]
+			if !ok || !equal(lp.Value, rp.Value, visited) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
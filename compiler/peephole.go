@@ -0,0 +1,212 @@
+package compiler
+
+import (
+	"github.com/songzhibin97/mini-compiler/code"
+)
+
+// SetPeephole 开启/关闭字节码窥孔优化, 默认关闭
+func (c *Compiler) SetPeephole(enable bool) {
+	c.peephole = enable
+}
+
+// peepholeInst 解码后的单条指令
+type peepholeInst struct {
+	op       code.Opcode
+	operands []int
+	offset   int  // 原始偏移量
+	target   int  // 跳转指令的目标(指令下标), 指向末尾时为 len(insts)
+	dead     bool // 已被删除
+}
+
+// isJump 操作数为跳转地址的指令
+func isJump(op code.Opcode) bool {
+	switch op {
+	case code.OpJump, code.OpJumpConditionNotTrue, code.OpJumpNotTrueOrPop, code.OpJumpTrueOrPop:
+		return true
+	}
+	return false
+}
+
+// optimize 对生成完毕的指令做窥孔优化, 返回新的指令与位置表
+//   - 删除跳转到下一条指令的跳转
+//   - 跳转目标为 OpJump 时直接跳转到最终目标
+//   - OpTrue OpJumpConditionNotTrue 删除, OpFalse/OpNil OpJumpConditionNotTrue 改为 OpJump
+//   - 删除 OpConstant OpPop 与 OpNil OpPop
+//
+// 位于末尾的 OpPop 会保留, 其弹出的值即为程序结果(LastPoppedStackElem)
+func optimize(ins code.Instructions, positions PosTable) (code.Instructions, PosTable) {
+	insts, ok := decodeInstructions(ins)
+	if !ok {
+		return ins, positions
+	}
+	for {
+		changed := optimizeSweep(insts)
+		insts = compact(insts)
+		if !changed {
+			break
+		}
+	}
+	return encodeInstructions(insts, positions)
+}
+
+func decodeInstructions(ins code.Instructions) ([]*peepholeInst, bool) {
+	var insts []*peepholeInst
+	index := make(map[int]int)
+	for i := 0; i < len(ins); {
+		def, err := code.FindDefinitionByOp(ins[i])
+		if err != nil {
+			return nil, false
+		}
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		index[i] = len(insts)
+		insts = append(insts, &peepholeInst{op: code.Opcode(ins[i]), operands: operands, offset: i})
+		i += read + 1
+	}
+	index[len(ins)] = len(insts)
+
+	for _, inst := range insts {
+		if !isJump(inst.op) {
+			continue
+		}
+		target, ok := index[inst.operands[0]]
+		if !ok {
+			// 跳转到指令中间, 不做优化
+			return nil, false
+		}
+		inst.target = target
+	}
+	return insts, true
+}
+
+// nextLive 下标 i 及之后第一条未删除的指令
+func nextLive(insts []*peepholeInst, i int) int {
+	for i < len(insts) && insts[i].dead {
+		i++
+	}
+	return i
+}
+
+// optimizeSweep 从前往后扫描一遍, 执行所有可以进行的改写, 没有任何改写时返回 false
+func optimizeSweep(insts []*peepholeInst) bool {
+	// 被跳转指向的指令不能与前一条指令合并删除
+	targeted := make(map[int]bool)
+	for _, inst := range insts {
+		if isJump(inst.op) {
+			targeted[inst.target] = true
+		}
+	}
+	// kill 删除指令, 指向它的跳转会落到下一条未删除的指令上
+	kill := func(i int) {
+		insts[i].dead = true
+		if targeted[i] {
+			targeted[nextLive(insts, i+1)] = true
+		}
+	}
+
+	changed := false
+	for i, inst := range insts {
+		if inst.dead {
+			continue
+		}
+		next := nextLive(insts, i+1)
+
+		if isJump(inst.op) {
+			// 跳转链
+			target := nextLive(insts, inst.target)
+			for steps := 0; target < len(insts) && target != i && insts[target].op == code.OpJump && steps < len(insts); steps++ {
+				target = nextLive(insts, insts[target].target)
+			}
+			if target != inst.target {
+				inst.target = target
+				targeted[target] = true
+				changed = true
+			}
+			// 跳转到下一条指令(OpJumpNotTrueOrPop/OpJumpTrueOrPop 是否跳转影响栈, 保留)
+			if target == next {
+				switch inst.op {
+				case code.OpJump:
+					kill(i)
+					changed = true
+				case code.OpJumpConditionNotTrue:
+					inst.op, inst.operands = code.OpPop, nil
+					changed = true
+				}
+			}
+			continue
+		}
+
+		if next >= len(insts) || targeted[next] {
+			continue
+		}
+		switch {
+		case insts[next].op == code.OpJumpConditionNotTrue && inst.op == code.OpTrue:
+			kill(i)
+			kill(next)
+			changed = true
+		case insts[next].op == code.OpJumpConditionNotTrue && (inst.op == code.OpFalse || inst.op == code.OpNil):
+			kill(i)
+			insts[next].op = code.OpJump
+			changed = true
+		case insts[next].op == code.OpPop && nextLive(insts, next+1) < len(insts) && (inst.op == code.OpConstant || inst.op == code.OpNil):
+			// 末尾的 OpPop 保留
+			kill(i)
+			kill(next)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// compact 移除已删除的指令并重新计算跳转目标(下标)
+func compact(insts []*peepholeInst) []*peepholeInst {
+	// index[i] 为下标 i 之前未删除的指令数量, 即 nextLive(i) 在新切片中的下标
+	index := make([]int, len(insts)+1)
+	live := make([]*peepholeInst, 0, len(insts))
+	for i, inst := range insts {
+		index[i] = len(live)
+		if !inst.dead {
+			live = append(live, inst)
+		}
+	}
+	index[len(insts)] = len(live)
+	for _, inst := range live {
+		if isJump(inst.op) {
+			inst.target = index[inst.target]
+		}
+	}
+	return live
+}
+
+func encodeInstructions(insts []*peepholeInst, positions PosTable) (code.Instructions, PosTable) {
+	// 计算新的偏移量, offsets[len(insts)] 为指令末尾
+	offsets := make([]int, len(insts)+1)
+	size := 0
+	for i, inst := range insts {
+		offsets[i] = size
+		if inst.dead {
+			continue
+		}
+		def, _ := code.FindDefinitionByOp(byte(inst.op))
+		size++
+		for _, w := range def.OperandWidths {
+			size += w
+		}
+	}
+	offsets[len(insts)] = size
+
+	ins := make(code.Instructions, 0, size)
+	var table PosTable
+	for i, inst := range insts {
+		if inst.dead {
+			continue
+		}
+		if isJump(inst.op) {
+			inst.operands = []int{offsets[nextLive(insts, inst.target)]}
+		}
+		if pos, ok := positions.Lookup(inst.offset); ok {
+			table = table.add(offsets[i], pos)
+		}
+		ins = append(ins, code.Make(inst.op, inst.operands...)...)
+	}
+	return ins, table
+}
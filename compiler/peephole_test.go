@@ -0,0 +1,176 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songzhibin97/mini-compiler/code"
+	"github.com/songzhibin97/mini-compiler/token"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    []code.Instructions
+		expected []code.Instructions
+	}{
+		{
+			// 跳转到下一条指令
+			input: []code.Instructions{
+				code.Make(code.OpJump, 3),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// 跳转链
+			input: []code.Instructions{
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpJumpConditionNotTrue, 11),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpPop),
+				code.Make(code.OpJump, 0),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpJumpConditionNotTrue, 0),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpPop),
+				code.Make(code.OpJump, 0),
+			},
+		},
+		{
+			input: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpConditionNotTrue, 7),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: []code.Instructions{
+				code.Make(code.OpFalse),
+				code.Make(code.OpJumpConditionNotTrue, 7),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpJump, 6),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpNil),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpNil),
+				code.Make(code.OpPop),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpNil),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// OpPop 是跳转目标, 不能删除
+			input: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpJump, 3),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpJump, 3),
+			},
+		},
+		{
+			// 短路跳转到下一条指令时会影响栈, 不能删除; 跳转到 OpJump 时直接跳转到最终目标
+			input: []code.Instructions{
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpJumpNotTrueOrPop, 6),
+				code.Make(code.OpJumpTrueOrPop, 9),
+				code.Make(code.OpJump, 12),
+				code.Make(code.OpPop),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpJumpNotTrueOrPop, 6),
+				code.Make(code.OpJumpTrueOrPop, 9),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		actual, _ := optimize(mergeInstruction(test.input), nil)
+		testInstructions(t, test.expected, actual)
+	}
+}
+
+func TestOptimizeSweep(t *testing.T) {
+	// 互不冲突的改写在同一次扫描中完成
+	var input []code.Instructions
+	for i := 0; i < 1000; i++ {
+		input = append(input, code.Make(code.OpConstant, 0), code.Make(code.OpPop))
+		input = append(input, code.Make(code.OpTrue), code.Make(code.OpJumpConditionNotTrue, 0))
+	}
+	input = append(input, code.Make(code.OpGetGlobal, 0), code.Make(code.OpPop))
+	insts, ok := decodeInstructions(mergeInstruction(input))
+	assert.Equal(t, true, ok)
+
+	assert.Equal(t, true, optimizeSweep(insts))
+	insts = compact(insts)
+	assert.Equal(t, 2, len(insts))
+	assert.Equal(t, false, optimizeSweep(insts))
+
+	actual, _ := optimize(mergeInstruction(input), nil)
+	testInstructions(t, []code.Instructions{
+		code.Make(code.OpGetGlobal, 0),
+		code.Make(code.OpPop),
+	}, actual)
+}
+
+func TestOptimizePositions(t *testing.T) {
+	compiler := NewCompiler()
+	compiler.SetPeephole(true)
+	err := compiler.Compiler(parse("var a = 1\n2\nif (true) {\n  a\n}"))
+	assert.NoError(t, err)
+	bytecode := compiler.Bytecode()
+
+	testInstructions(t, []code.Instructions{
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpSetGlobal, 0),
+		code.Make(code.OpGetGlobal, 0),
+		code.Make(code.OpJump, 13),
+		code.Make(code.OpNil),
+		code.Make(code.OpPop),
+	}, bytecode.Instructions)
+	assert.Equal(t, PosTable{
+		{Offset: 0, Pos: token.Position{Line: 1, Column: 9}},
+		{Offset: 3, Pos: token.Position{Line: 1, Column: 1}},
+		{Offset: 6, Pos: token.Position{Line: 4, Column: 3}},
+		{Offset: 9, Pos: token.Position{Line: 3, Column: 1}},
+	}, bytecode.Positions)
+}
@@ -0,0 +1,43 @@
+package compiler
+
+import (
+	"sort"
+
+	"github.com/songzhibin97/mini-compiler/token"
+)
+
+// PosEntry 从 Offset 开始的指令对应的源码位置
+type PosEntry struct {
+	Offset int
+	Pos    token.Position
+}
+
+// PosTable 指令偏移量到源码位置的映射, 按 Offset 递增排列
+type PosTable []PosEntry
+
+// Lookup 查找偏移量 offset 处指令对应的源码位置
+func (t PosTable) Lookup(offset int) (token.Position, bool) {
+	idx := sort.Search(len(t), func(i int) bool { return t[i].Offset > offset })
+	if idx == 0 {
+		return token.Position{}, false
+	}
+	return t[idx-1].Pos, true
+}
+
+// add 记录从 offset 开始的指令位置, 与上一条记录位置相同时不重复记录
+func (t PosTable) add(offset int, pos token.Position) PosTable {
+	if len(t) != 0 && t[len(t)-1].Pos == pos {
+		return t
+	}
+	if len(t) != 0 && t[len(t)-1].Offset == offset {
+		t[len(t)-1].Pos = pos
+		return t
+	}
+	return append(t, PosEntry{Offset: offset, Pos: pos})
+}
+
+// truncate 删除 offset 及之后的记录
+func (t PosTable) truncate(offset int) PosTable {
+	idx := sort.Search(len(t), func(i int) bool { return t[i].Offset >= offset })
+	return t[:idx]
+}
@@ -0,0 +1,38 @@
+package compiler
+
+import (
+	"github.com/songzhibin97/mini-compiler/code"
+)
+
+// markTailCalls 将尾部位置的 OpCall 改写为 OpTailCall
+// OpCall 之后紧跟 OpReturnValue, 或经过 OpJump 到达 OpReturnValue 时为尾调用
+// 两条指令宽度相同, 不影响跳转地址与位置表
+func markTailCalls(ins code.Instructions) {
+	for i := 0; i < len(ins); {
+		def, err := code.FindDefinitionByOp(ins[i])
+		if err != nil {
+			return
+		}
+		_, read := code.ReadOperands(def, ins[i+1:])
+		next := i + read + 1
+		if code.Opcode(ins[i]) == code.OpCall && reachesReturn(ins, next) {
+			ins[i] = byte(code.OpTailCall)
+		}
+		i = next
+	}
+}
+
+// reachesReturn 从 offset 开始执行是否直接到达 OpReturnValue
+func reachesReturn(ins code.Instructions, offset int) bool {
+	for steps := 0; offset < len(ins) && steps < len(ins); steps++ {
+		switch code.Opcode(ins[offset]) {
+		case code.OpReturnValue:
+			return true
+		case code.OpJump:
+			offset = int(code.ReadUint16(ins[offset+1:]))
+		default:
+			return false
+		}
+	}
+	return false
+}
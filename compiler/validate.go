@@ -0,0 +1,253 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/songzhibin97/mini-compiler/code"
+)
+
+var (
+	ErrInvalidInstruction = errors.New("bytecode: invalid instruction")
+	ErrBuiltinMismatch    = errors.New("bytecode: builtin mismatch")
+)
+
+// CheckBuiltins 检查字节码引用的内置函数在 builtins 中的编号与编译时一致
+// 使用不同注册表编译的字节码会绑定到错误的函数, 加载时应先调用
+func (b *Bytecode) CheckBuiltins(builtins *Builtins) error {
+	for idx, name := range b.Builtins {
+		if name == "" {
+			continue
+		}
+		builtin := builtins.Get(idx)
+		if builtin == nil {
+			return fmt.Errorf("%w: %s (index %d) is not registered", ErrBuiltinMismatch, name, idx)
+		}
+		if builtin.Name != name {
+			return fmt.Errorf("%w: index %d is %s, want %s", ErrBuiltinMismatch, idx, builtin.Name, name)
+		}
+	}
+	return nil
+}
+
+// validate 检查反序列化得到的指令, 保证虚拟机执行时不会因为非法的操作码或操作数而 panic:
+// 操作码已定义且操作数完整, 常量下标在常量池内且类型正确, 跳转目标位于指令边界,
+// 内置函数已记录, 局部变量与闭包捕获变量的下标不超过函数声明的数量,
+// 任意执行路径上栈都不会弹空, main 中没有 return/尾调用, 函数不会执行到末尾而不返回
+func (b *Bytecode) validate() error {
+	main := &CompiledFunction{Name: "main", Instructions: b.Instructions}
+	fns := []*CompiledFunction{main}
+	for _, constant := range b.Constants {
+		if fn, ok := constant.(*CompiledFunction); ok {
+			if fn.NumParameters > fn.NumLocals {
+				return fmt.Errorf("%w: %s has %d parameters but %d locals", ErrInvalidInstruction, fn.Name, fn.NumParameters, fn.NumLocals)
+			}
+			fns = append(fns, fn)
+		}
+	}
+
+	// 第一遍检查编码与常量引用, 并统计每个函数被 OpClosure 捕获的最少变量数, main 没有捕获变量
+	captures := map[*CompiledFunction]int{main: 0}
+	for _, fn := range fns {
+		starts := boundaries(fn.Instructions)
+		err := walk(fn, func(op code.Opcode, operands []int) error {
+			switch op {
+			case code.OpConstant, code.OpClosure:
+				if operands[0] >= len(b.Constants) {
+					return fmt.Errorf("constant index %d out of range", operands[0])
+				}
+				target, isFn := b.Constants[operands[0]].(*CompiledFunction)
+				if op == code.OpConstant && isFn {
+					return fmt.Errorf("constant %d is a function", operands[0])
+				}
+				if op == code.OpClosure {
+					if !isFn {
+						return fmt.Errorf("constant %d is not a function", operands[0])
+					}
+					if n, ok := captures[target]; !ok || operands[1] < n {
+						captures[target] = operands[1]
+					}
+				}
+			case code.OpJump, code.OpJumpConditionNotTrue, code.OpJumpNotTrueOrPop, code.OpJumpTrueOrPop:
+				if !starts[operands[0]] {
+					return fmt.Errorf("jump target %d is not an instruction boundary", operands[0])
+				}
+			case code.OpGetBuiltin:
+				if operands[0] >= len(b.Builtins) || b.Builtins[operands[0]] == "" {
+					return fmt.Errorf("builtin index %d is not recorded", operands[0])
+				}
+			case code.OpGetLocal, code.OpSetLocal, code.OpCaptureLocal:
+				if operands[0] >= fn.NumLocals {
+					return fmt.Errorf("local index %d out of range", operands[0])
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, fn := range fns {
+		err := checkStack(fn, fn == main)
+		if err != nil {
+			return err
+		}
+	}
+
+	// 第二遍检查捕获变量下标, 未被任何 OpClosure 引用的函数不会执行
+	for _, fn := range fns {
+		n, ok := captures[fn]
+		if !ok {
+			continue
+		}
+		err := walk(fn, func(op code.Opcode, operands []int) error {
+			switch op {
+			case code.OpContext, code.OpSetContext, code.OpCaptureContext:
+				if operands[0] >= n {
+					return fmt.Errorf("context index %d out of range", operands[0])
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkStack 沿所有执行路径计算每条指令执行前栈上(当前帧局部变量之上)最少的元素个数,
+// 元素不足以弹出时返回错误. 指令已经过 walk 检查, 可以直接解码
+func checkStack(fn *CompiledFunction, isMain bool) error {
+	ins := fn.Instructions
+	depths := map[int]int{0: 0}
+	work := []int{0}
+	for len(work) > 0 {
+		offset := work[len(work)-1]
+		work = work[:len(work)-1]
+		depth := depths[offset]
+		if offset == len(ins) {
+			if !isMain {
+				return fmt.Errorf("%w: %s ends without return", ErrInvalidInstruction, fn.Name)
+			}
+			continue
+		}
+
+		op := code.Opcode(ins[offset])
+		def, _ := code.FindDefinitionByOp(ins[offset])
+		operands, read := code.ReadOperands(def, ins[offset+1:])
+		next := offset + 1 + read
+		if isMain && (op == code.OpReturnValue || op == code.OpReturn || op == code.OpTailCall) {
+			return fmt.Errorf("%w: main at offset %d: %s outside function", ErrInvalidInstruction, offset, def.Name)
+		}
+		pop, push, err := stackEffect(op, operands)
+		if err != nil {
+			return fmt.Errorf("%w: %s at offset %d: %s", ErrInvalidInstruction, fn.Name, offset, err)
+		}
+		if depth < pop {
+			return fmt.Errorf("%w: %s at offset %d: %s pops %d of %d values on the stack",
+				ErrInvalidInstruction, fn.Name, offset, def.Name, pop, depth)
+		}
+
+		// 后继指令及执行到该处时的栈深度
+		var succ [2][2]int
+		n := 0
+		switch op {
+		case code.OpReturnValue, code.OpReturn:
+		case code.OpJump:
+			succ[0], n = [2]int{operands[0], depth}, 1
+		case code.OpJumpNotTrueOrPop, code.OpJumpTrueOrPop:
+			// 跳转时保留栈顶, 否则弹出
+			succ[0], succ[1], n = [2]int{operands[0], depth}, [2]int{next, depth - 1}, 2
+		case code.OpJumpConditionNotTrue:
+			succ[0], succ[1], n = [2]int{operands[0], depth - 1}, [2]int{next, depth - 1}, 2
+		default:
+			succ[0], n = [2]int{next, depth - pop + push}, 1
+		}
+		for _, s := range succ[:n] {
+			if d, ok := depths[s[0]]; !ok || s[1] < d {
+				depths[s[0]] = s[1]
+				work = append(work, s[0])
+			}
+		}
+	}
+	return nil
+}
+
+// stackEffect 返回指令弹出与压入的栈元素个数, 跳转与返回指令由 checkStack 单独处理
+func stackEffect(op code.Opcode, operands []int) (int, int, error) {
+	switch op {
+	case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNil,
+		code.OpGetBuiltin, code.OpGetGlobal, code.OpGetLocal,
+		code.OpContext, code.OpCaptureLocal, code.OpCaptureContext, code.OpCurrClosure:
+		return 0, 1, nil
+	case code.OpPop, code.OpSetGlobal, code.OpSetLocal, code.OpSetContext:
+		return 1, 0, nil
+	case code.OpArray, code.OpMap, code.OpClosure:
+		return operands[len(operands)-1], 1, nil
+	case code.OpIndex,
+		code.OpAdd, code.OpSub, code.OpMul, code.OpQuo, code.OpRem,
+		code.OpAnd, code.OpOr, code.OpXor, code.OpShl, code.OpShr,
+		code.OpEQL, code.OpNEQ, code.OpGTR, code.OpLSS, code.OpLEQ, code.OpGEQ:
+		return 2, 1, nil
+	case code.OpSetIndex:
+		return 3, 0, nil
+	case code.OpMinus, code.OpBang, code.OpBitNot:
+		return 1, 1, nil
+	case code.OpCall, code.OpTailCall:
+		// 调用内置函数的尾调用与普通调用相同, 结果留在栈上
+		return operands[0] + 1, 1, nil
+	case code.OpReturnValue, code.OpJumpConditionNotTrue, code.OpJumpNotTrueOrPop, code.OpJumpTrueOrPop:
+		return 1, 0, nil
+	case code.OpReturn, code.OpJump:
+		return 0, 0, nil
+	}
+	return 0, 0, fmt.Errorf("unknown stack effect of opcode %d", op)
+}
+
+// walk 逐条解码 fn 的指令并调用 f, 遇到未定义的操作码或不完整的操作数时返回错误
+func walk(fn *CompiledFunction, f func(op code.Opcode, operands []int) error) error {
+	ins := fn.Instructions
+	for offset := 0; offset < len(ins); {
+		def, err := code.FindDefinitionByOp(ins[offset])
+		if err == nil && offset+1+operandWidth(def) > len(ins) {
+			err = errors.New("truncated operands")
+		}
+		if err == nil {
+			operands, read := code.ReadOperands(def, ins[offset+1:])
+			err = f(code.Opcode(ins[offset]), operands)
+			if err == nil {
+				offset += 1 + read
+				continue
+			}
+		}
+		return fmt.Errorf("%w: %s at offset %d: %s", ErrInvalidInstruction, fn.Name, offset, err)
+	}
+	return nil
+}
+
+// boundaries 返回每条指令的起始位置, 末尾(len(ins))同样是合法的跳转目标
+// 遇到未定义的操作码时停止, 由 walk 报告错误
+func boundaries(ins code.Instructions) map[int]bool {
+	starts := map[int]bool{}
+	offset := 0
+	for offset < len(ins) {
+		def, err := code.FindDefinitionByOp(ins[offset])
+		if err != nil {
+			return starts
+		}
+		starts[offset] = true
+		offset += 1 + operandWidth(def)
+	}
+	starts[offset] = offset == len(ins)
+	return starts
+}
+
+func operandWidth(def *code.Definition) int {
+	width := 0
+	for _, w := range def.OperandWidths {
+		width += w
+	}
+	return width
+}
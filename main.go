@@ -1,11 +1,255 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/songzhibin97/mini-compiler/compiler"
+	"github.com/songzhibin97/mini-compiler/lexer"
+	"github.com/songzhibin97/mini-compiler/parser"
 	"github.com/songzhibin97/mini-compiler/repl"
+	"github.com/songzhibin97/mini-compiler/vm"
 )
 
+// 退出码
+const (
+	exitOK = iota
+	exitUsage
+	exitParse
+	exitCompile
+	exitRuntime
+)
+
+const usage = `usage: mini-compiler <command> [arguments]
+
+commands:
+	run    <file.mini> [-O]                   编译并运行源码
+	build  <file.mini> [-O] [-o file.minic]   编译源码并输出字节码文件
+	exec   <file.minic>                       运行字节码文件
+	disasm <file> [-O]                        反汇编源码或字节码文件
+	repl                                      交互式环境
+
+flags:
+	-O     开启常量折叠与窥孔优化
+`
+
+// exitError 携带退出码的错误
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+
+func fail(code int, format string, args ...interface{}) error {
+	return &exitError{code: code, err: fmt.Errorf(format, args...)}
+}
+
 func main() {
-	repl.Start(os.Stdin, os.Stdout)
+	err := execute(os.Args[1:], os.Stdin, os.Stdout)
+	if err == nil {
+		return
+	}
+	_, _ = fmt.Fprintln(os.Stderr, err)
+	if e, ok := err.(*exitError); ok {
+		os.Exit(e.code)
+	}
+	os.Exit(exitUsage)
+}
+
+func execute(args []string, in io.Reader, out io.Writer) error {
+	if len(args) == 0 {
+		repl.Start(in, out)
+		return nil
+	}
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "run":
+		return runCmd(args)
+	case "build":
+		return buildCmd(args)
+	case "exec":
+		return execCmd(args)
+	case "disasm":
+		return disasmCmd(args, out)
+	case "repl":
+		repl.Start(in, out)
+		return nil
+	case "help", "-h", "--help":
+		_, _ = io.WriteString(out, usage)
+		return nil
+	default:
+		return fail(exitUsage, "unknown command %q\n%s", cmd, usage)
+	}
+}
+
+// parseArgs 解析参数, 允许标志出现在文件参数之后(build a.mini -o a.minic)
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		err := fs.Parse(args)
+		if err != nil {
+			return nil, fail(exitUsage, "%s", err)
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func fileArg(name string, args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fail(exitUsage, "%s: expected exactly one file argument\n%s", name, usage)
+	}
+	return args[0], nil
+}
+
+func runCmd(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	optimize := fs.Bool("O", false, "enable optimizations")
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	file, err := fileArg("run", args)
+	if err != nil {
+		return err
+	}
+	bytecode, err := compileFile(file, *optimize)
+	if err != nil {
+		return err
+	}
+	return runBytecode(bytecode)
+}
+
+func buildCmd(args []string) error {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	output := fs.String("o", "", "output file")
+	optimize := fs.Bool("O", false, "enable optimizations")
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	file, err := fileArg("build", args)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		*output = strings.TrimSuffix(file, filepath.Ext(file)) + ".minic"
+	}
+
+	bytecode, err := compileFile(file, *optimize)
+	if err != nil {
+		return err
+	}
+	data, err := bytecode.MarshalBinary()
+	if err != nil {
+		return fail(exitCompile, "%s: %s", file, err)
+	}
+	err = os.WriteFile(*output, data, 0o644)
+	if err != nil {
+		return fail(exitUsage, "%s", err)
+	}
+	return nil
+}
+
+func execCmd(args []string) error {
+	file, err := fileArg("exec", args)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fail(exitUsage, "%s", err)
+	}
+	bytecode := &compiler.Bytecode{}
+	err = bytecode.UnmarshalBinary(data)
+	if err == nil {
+		err = bytecode.CheckBuiltins(compiler.DefaultBuiltins())
+	}
+	if err != nil {
+		return fail(exitUsage, "%s: %s", file, err)
+	}
+	return runBytecode(bytecode)
+}
+
+func disasmCmd(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("disasm", flag.ContinueOnError)
+	optimize := fs.Bool("O", false, "enable optimizations")
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	file, err := fileArg("disasm", args)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fail(exitUsage, "%s", err)
+	}
+
+	bytecode := &compiler.Bytecode{}
+	if compiler.IsBytecode(data) {
+		err = bytecode.UnmarshalBinary(data)
+		if err != nil {
+			return fail(exitUsage, "%s: %s", file, err)
+		}
+	} else {
+		bytecode, err = compileSource(file, string(data), *optimize)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, _ = fmt.Fprintf(out, "== main ==\n%s", bytecode.Instructions)
+	for i, constant := range bytecode.Constants {
+		if fn, ok := constant.(*compiler.CompiledFunction); ok {
+			_, _ = fmt.Fprintf(out, "\n== constant %d: %s locals=%d params=%d ==\n%s",
+				i, fn.Name, fn.NumLocals, fn.NumParameters, fn.Instructions)
+		}
+	}
+	return nil
+}
+
+func compileFile(file string, optimize bool) (*compiler.Bytecode, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fail(exitUsage, "%s", err)
+	}
+	return compileSource(file, string(data), optimize)
+}
+
+func compileSource(file string, src string, optimize bool) (*compiler.Bytecode, error) {
+	p := parser.NewParser(lexer.NewLexer(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fail(exitParse, "%s: parse failed:\n\t%s", file, strings.Join(p.Errors(), "\n\t"))
+	}
+	comp := compiler.NewCompiler()
+	comp.SetFile(file)
+	comp.SetConstantFolding(optimize)
+	comp.SetPeephole(optimize)
+	err := comp.Compiler(program)
+	if err != nil {
+		return nil, fail(exitCompile, "%s: compilation failed: %s", file, err)
+	}
+	return comp.Bytecode(), nil
+}
+
+func runBytecode(bytecode *compiler.Bytecode) error {
+	err := vm.NewVM(bytecode).Run()
+	if re, ok := err.(*vm.RuntimeError); ok {
+		return fail(exitRuntime, "vm failed: %s", re.StackTrace())
+	}
+	if err != nil {
+		return fail(exitRuntime, "vm failed: %s", err)
+	}
+	return nil
 }
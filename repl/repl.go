@@ -10,8 +10,8 @@ import (
 	"github.com/songzhibin97/mini-compiler/vm"
 
 	"github.com/songzhibin97/mini-compiler/compiler"
-	"github.com/songzhibin97/mini-interpreter/lexer"
-	"github.com/songzhibin97/mini-interpreter/parser"
+	"github.com/songzhibin97/mini-compiler/lexer"
+	"github.com/songzhibin97/mini-compiler/parser"
 )
 
 const PROMPT = ">>>"
@@ -20,9 +20,7 @@ func Start(in io.Reader, out io.Writer) {
 	fmt.Println("Welcome to Mini-compiler")
 	scanner := bufio.NewScanner(in)
 	symbolTable := compiler.NewSymbolTable()
-	for i, s := range compiler.IterBuiltin() {
-		symbolTable.DefineBuiltin(i, s)
-	}
+	compiler.DefaultBuiltins().Define(symbolTable)
 	globals := make([]object.Object, vm.GlobalsSize)
 	constants := []object.Object{}
 	for {
@@ -38,6 +36,7 @@ func Start(in io.Reader, out io.Writer) {
 			for _, s := range p.Errors() {
 				_, _ = io.WriteString(out, "\t"+s+"\r\n")
 			}
+			continue
 		}
 		comp := compiler.NewCompilerWithSymbol(symbolTable, constants)
 		err := comp.Compiler(program)
@@ -46,13 +45,17 @@ func Start(in io.Reader, out io.Writer) {
 			continue
 		}
 		constants = comp.Bytecode().Constants
-		v := vm.NewVMWithGlobals(comp.Bytecode(), globals)
+		v := vm.NewVMWithGlobals(comp.Bytecode(), globals, vm.WithStdout(out))
 		err = v.Run()
 		if err != nil {
 			_, _ = io.WriteString(out, "\t VM failed:"+err.Error()+"\r\n")
 			continue
 		}
 		lastPopped := v.LastPoppedStackElem()
+		if lastPopped == nil {
+			// 循环等语句不产生值
+			continue
+		}
 		_, _ = io.WriteString(out, lastPopped.Inspect())
 		_, _ = io.WriteString(out, "\n")
 	}
@@ -0,0 +1,28 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStart(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "1 + 2", expected: PROMPT + "3\n" + PROMPT},
+		{input: "var a = 1\na + 1", expected: PROMPT + "1\n" + PROMPT + "2\n" + PROMPT},
+		// 不产生值的语句
+		{input: "for (;;) { break }\n1", expected: PROMPT + PROMPT + "1\n" + PROMPT},
+		{input: "for (;;) { break }", expected: PROMPT + PROMPT},
+		{input: "1 +", expected: PROMPT + "\tno prefix parse function for EOF found\r\n" + PROMPT},
+	}
+	for _, test := range tests {
+		out := &bytes.Buffer{}
+		Start(strings.NewReader(test.input), out)
+		assert.Equal(t, test.expected, out.String(), test.input)
+	}
+}
@@ -0,0 +1,180 @@
+// Package script 提供在 Go 程序中嵌入脚本的高层接口
+//
+//	s, err := script.Compile(`func add(a, b) { a + b } var c = add(x, 1)`, script.WithGlobals("x"))
+//	_ = s.SetGlobal("x", &object.Integer{Value: 1})
+//	err = s.Run()
+//	c, err := s.GetGlobal("c")
+//	sum, err := s.Call("add", &object.Integer{Value: 1}, &object.Integer{Value: 2})
+//
+// Script 不是并发安全的
+package script
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/songzhibin97/mini-interpreter/object"
+
+	"github.com/songzhibin97/mini-compiler/compiler"
+	"github.com/songzhibin97/mini-compiler/lexer"
+	"github.com/songzhibin97/mini-compiler/parser"
+	"github.com/songzhibin97/mini-compiler/vm"
+)
+
+var ErrNotRun = errors.New("script has not been run")
+
+// Script 编译完成的脚本, 可以多次运行, 全局变量在多次运行之间保留
+type Script struct {
+	file        string
+	names       []string           // 由宿主提供的全局变量
+	builtins    *compiler.Builtins // 内置函数注册表
+	vmOptions   []vm.Option        // 创建虚拟机时使用的配置
+	optimize    bool
+	symbolTable *compiler.SymbolTable
+	bytecode    *compiler.Bytecode
+	globals     []object.Object
+	vm          *vm.VM // 最近一次成功运行的虚拟机, Call 复用它
+}
+
+// Option 脚本配置项
+type Option func(s *Script)
+
+// WithGlobals 预先声明由宿主通过 SetGlobal 提供的全局变量, 脚本中可以直接引用
+func WithGlobals(names ...string) Option {
+	return func(s *Script) {
+		s.names = append(s.names, names...)
+	}
+}
+
+// WithBuiltins 设置内置函数注册表, 默认 compiler.DefaultBuiltins()
+func WithBuiltins(builtins *compiler.Builtins) Option {
+	return func(s *Script) {
+		s.builtins = builtins
+	}
+}
+
+// WithVMOptions 设置运行脚本的虚拟机配置(栈大小/gas/内存限制等)
+// gas 与内存限制从每次 Run 开始计算, 之后的 Call 累计在同一份额度内
+func WithVMOptions(opts ...vm.Option) Option {
+	return func(s *Script) {
+		s.vmOptions = append(s.vmOptions, opts...)
+	}
+}
+
+// WithFile 设置源文件名, 用于错误定位
+func WithFile(file string) Option {
+	return func(s *Script) {
+		s.file = file
+	}
+}
+
+// WithOptimization 开启常量折叠与窥孔优化
+func WithOptimization() Option {
+	return func(s *Script) {
+		s.optimize = true
+	}
+}
+
+// Compile 编译脚本
+func Compile(src string, opts ...Option) (*Script, error) {
+	s := &Script{}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.builtins == nil {
+		s.builtins = compiler.DefaultBuiltins()
+	}
+	s.vmOptions = append(s.vmOptions, vm.WithBuiltins(s.builtins))
+
+	p := parser.NewParser(lexer.NewLexer(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("parse failed: %s", strings.Join(p.Errors(), "; "))
+	}
+
+	s.symbolTable = compiler.NewSymbolTable()
+	s.builtins.Define(s.symbolTable)
+	for _, name := range s.names {
+		if _, ok := s.symbolTable.GetDefine(name); ok {
+			return nil, fmt.Errorf("global %s is already defined", name)
+		}
+		s.symbolTable.Define(name)
+	}
+
+	comp := compiler.NewCompilerWithSymbol(s.symbolTable, []object.Object{})
+	comp.SetFile(s.file)
+	comp.SetConstantFolding(s.optimize)
+	comp.SetPeephole(s.optimize)
+	err := comp.Compiler(program)
+	if err != nil {
+		return nil, fmt.Errorf("compilation failed: %w", err)
+	}
+	s.bytecode = comp.Bytecode()
+	s.globals = make([]object.Object, vm.GlobalsSize)
+	return s, nil
+}
+
+// Run 运行脚本
+func (s *Script) Run() error {
+	return s.RunContext(context.Background())
+}
+
+// RunContext 运行脚本, ctx 结束时停止执行
+func (s *Script) RunContext(ctx context.Context) error {
+	s.vm = nil
+	v := vm.NewVMWithGlobals(s.bytecode, s.globals, s.vmOptions...)
+	err := v.RunContext(ctx)
+	if err != nil {
+		return err
+	}
+	s.vm = v
+	return nil
+}
+
+// global 查找全局变量
+func (s *Script) global(name string) (compiler.Symbol, error) {
+	symbol, ok := s.symbolTable.GetDefine(name)
+	if !ok || symbol.Scope != compiler.GlobalScope {
+		return symbol, fmt.Errorf("undefined global %s", name)
+	}
+	return symbol, nil
+}
+
+// SetGlobal 设置全局变量的值
+func (s *Script) SetGlobal(name string, value object.Object) error {
+	symbol, err := s.global(name)
+	if err != nil {
+		return err
+	}
+	s.globals[symbol.Index] = value
+	return nil
+}
+
+// GetGlobal 获取全局变量的值, 未赋值时为 nil 对象
+func (s *Script) GetGlobal(name string) (object.Object, error) {
+	symbol, err := s.global(name)
+	if err != nil {
+		return nil, err
+	}
+	value := s.globals[symbol.Index]
+	if value == nil {
+		return vm.Nil, nil
+	}
+	return value, nil
+}
+
+// Call 调用脚本中定义的全局函数, 需要先运行脚本
+// 调用在运行脚本的虚拟机中执行, 消耗的 gas 与内存计入该次 Run 的限制, 不会在每次调用时重置
+func (s *Script) Call(name string, args ...object.Object) (object.Object, error) {
+	if s.vm == nil {
+		return nil, ErrNotRun
+	}
+	symbol, err := s.global(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.vm.Call(s.globals[symbol.Index], args...)
+}
@@ -0,0 +1,203 @@
+package script
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songzhibin97/mini-compiler/compiler"
+	"github.com/songzhibin97/mini-compiler/vm"
+	"github.com/songzhibin97/mini-interpreter/object"
+)
+
+func TestScript(t *testing.T) {
+	s, err := Compile(`
+	func add(a, b) { a + b }
+	var count = 0
+	func incr() { count = count + 1 count }
+	var c = add(x, 1)
+	`, WithGlobals("x"))
+	assert.NoError(t, err)
+
+	_, err = s.Call("add", &object.Integer{Value: 1}, &object.Integer{Value: 2})
+	assert.Equal(t, ErrNotRun, err)
+
+	assert.NoError(t, s.SetGlobal("x", &object.Integer{Value: 41}))
+	assert.NoError(t, s.Run())
+
+	c, err := s.GetGlobal("c")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), c.(*object.Integer).Value)
+
+	sum, err := s.Call("add", &object.Integer{Value: 1}, &object.Integer{Value: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), sum.(*object.Integer).Value)
+
+	// 全局变量在多次调用/运行之间保留
+	for i := 1; i <= 3; i++ {
+		n, err := s.Call("incr")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(i), n.(*object.Integer).Value)
+	}
+	assert.NoError(t, s.SetGlobal("x", &object.Integer{Value: 1}))
+	assert.NoError(t, s.Run())
+	c, err = s.GetGlobal("c")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), c.(*object.Integer).Value)
+	count, err := s.GetGlobal("count")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), count.(*object.Integer).Value)
+
+	_, err = s.GetGlobal("y")
+	assert.Error(t, err)
+	assert.Error(t, s.SetGlobal("len", &object.Integer{Value: 1}))
+	_, err = s.Call("count")
+	assert.Error(t, err)
+	_, err = s.Call("add", &object.Integer{Value: 1})
+	assert.Error(t, err)
+}
+
+func TestScript_Compile(t *testing.T) {
+	_, err := Compile(`var a = `)
+	assert.Error(t, err)
+	_, err = Compile(`a + 1`)
+	assert.Error(t, err)
+	_, err = Compile(`1`, WithGlobals("len"))
+	assert.Error(t, err)
+
+	s, err := Compile(`var a = 2 * 3 while (true) { }`, WithOptimization(), WithVMOptions(vm.WithBudget(1000)))
+	assert.NoError(t, err)
+	err = s.Run()
+	assert.True(t, errors.Is(err, vm.ErrBudgetExceeded))
+	a, err := s.GetGlobal("a")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), a.(*object.Integer).Value)
+}
+
+func TestScript_CallLimits(t *testing.T) {
+	tests := []struct {
+		opt      vm.Option
+		expected error
+	}{
+		{opt: vm.WithBudget(5000), expected: vm.ErrBudgetExceeded},
+		{opt: vm.WithMemoryLimit(10000), expected: vm.ErrMemoryLimit},
+	}
+	for _, test := range tests {
+		s, err := Compile(`func work() { var a = [1, 2, 3, 4, 5, 6, 7, 8] len(a) }`, WithVMOptions(test.opt))
+		assert.NoError(t, err)
+		assert.NoError(t, s.Run())
+
+		// 多次调用累计在同一份额度内, 最终超出限制
+		calls := 0
+		for ; calls < 1000; calls++ {
+			_, err = s.Call("work")
+			if err != nil {
+				break
+			}
+		}
+		assert.True(t, errors.Is(err, test.expected), "got %v", err)
+		assert.Greater(t, calls, 1)
+
+		// 重新运行后额度重新计算
+		assert.NoError(t, s.Run())
+		_, err = s.Call("work")
+		assert.NoError(t, err)
+	}
+}
+
+func TestScript_Builtins(t *testing.T) {
+	builtins := compiler.NewBuiltins()
+	assert.NoError(t, builtins.Register("twice", 2, func(rt compiler.Runtime, args ...object.Object) (object.Object, error) {
+		v, err := rt.Call(args[0], args[1])
+		if err != nil {
+			return nil, err
+		}
+		return rt.Call(args[0], v)
+	}))
+
+	_, err := Compile(`len("")`, WithBuiltins(builtins))
+	assert.Error(t, err)
+
+	s, err := Compile(`func inc(x) { x + 1 } var a = twice(inc, 1)`, WithBuiltins(builtins))
+	assert.NoError(t, err)
+	assert.NoError(t, s.Run())
+	a, err := s.GetGlobal("a")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), a.(*object.Integer).Value)
+	// 内置函数不是全局变量
+	_, err = s.Call("twice")
+	assert.Error(t, err)
+}
+
+func TestScript_RegisterFunc(t *testing.T) {
+	type user struct {
+		Name string
+		Age  int
+	}
+	errNotFound := errors.New("not found")
+
+	builtins := compiler.DefaultBuiltins()
+	assert.NoError(t, builtins.RegisterFunc("repeat", strings.Repeat))
+	assert.NoError(t, builtins.RegisterFunc("user", func(name string) (*user, error) {
+		if name == "" {
+			return nil, errNotFound
+		}
+		return &user{Name: name, Age: 18}, nil
+	}))
+	assert.NoError(t, builtins.RegisterFunc("apply", func(rt compiler.Runtime, fn object.Object, xs []int64) ([]int64, error) {
+		res := make([]int64, 0, len(xs))
+		for _, x := range xs {
+			v, err := rt.Call(fn, &object.Integer{Value: x})
+			if err != nil {
+				return nil, err
+			}
+			var n int64
+			err = compiler.FromObject(v, &n)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, n)
+		}
+		return res, nil
+	}))
+	assert.NoError(t, builtins.RegisterFunc("first", func(xs []int64) int64 { return xs[0] }))
+
+	s, err := Compile(`
+	var a = repeat("ab", 2)
+	var u = user("mini")
+	var age = u["Age"]
+	func double(x) { x * 2 }
+	var b = apply(double, [1, 2, 3])
+	`, WithBuiltins(builtins))
+	assert.NoError(t, err)
+	assert.NoError(t, s.Run())
+
+	a, _ := s.GetGlobal("a")
+	assert.Equal(t, "abab", a.Inspect())
+	age, _ := s.GetGlobal("age")
+	assert.Equal(t, "18", age.Inspect())
+	b, _ := s.GetGlobal("b")
+	var doubled []int
+	assert.NoError(t, compiler.FromObject(b, &doubled))
+	assert.Equal(t, []int{2, 4, 6}, doubled)
+
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{input: `user("")`, err: "1:5: not found"},
+		{input: `repeat(1, 2)`, err: "1:7: argument 1 to repeat: cannot convert INT to string"},
+		{input: `apply(repeat, [1])`, err: "1:6: wrong number of arguments to repeat: want=2, got=1"},
+		// Go 函数中的 panic 作为运行时错误返回
+		{input: `first([])`, err: "1:6: builtin first panicked: runtime error: index out of range [0] with length 0"},
+	}
+	for _, test := range tests {
+		s, err := Compile(test.input, WithBuiltins(builtins))
+		assert.NoError(t, err)
+		assert.EqualError(t, s.Run(), test.err, test.input)
+	}
+	s, _ = Compile(`user("")`, WithBuiltins(builtins))
+	assert.True(t, errors.Is(s.Run(), errNotFound))
+}
@@ -0,0 +1,36 @@
+package vm
+
+import (
+	"errors"
+	"math"
+
+	"github.com/songzhibin97/mini-compiler/code"
+)
+
+var ErrIntegerOverflow = errors.New("integer overflow")
+
+// WithCheckedArithmetic 开启溢出检查, 整数 + - * / 与取负溢出时 Run 返回 ErrIntegerOverflow
+// 默认关闭, 溢出时按 int64 补码回绕
+func WithCheckedArithmetic() Option {
+	return func(c *config) {
+		c.checked = true
+	}
+}
+
+// integerOverflows 判断 lv op rv 的结果 result 是否溢出
+func integerOverflows(op code.Opcode, lv, rv, result int64) bool {
+	switch op {
+	case code.OpAdd:
+		return (result > lv) != (rv > 0)
+	case code.OpSub:
+		return (result < lv) != (rv > 0)
+	case code.OpMul:
+		if lv == 0 {
+			return false
+		}
+		return result/lv != rv || (lv == -1 && rv == math.MinInt64)
+	case code.OpQuo:
+		return lv == math.MinInt64 && rv == -1
+	}
+	return false
+}
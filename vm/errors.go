@@ -0,0 +1,113 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/songzhibin97/mini-compiler/code"
+	"github.com/songzhibin97/mini-compiler/token"
+)
+
+// StackFrame 调用栈中的一帧
+type StackFrame struct {
+	Name   string         // 函数名, 顶层代码为 main
+	Offset int            // 指令偏移量
+	File   string         // 源文件名
+	Pos    token.Position // 源码位置, 未记录时为零值
+}
+
+func (f StackFrame) String() string {
+	location := f.Pos.String()
+	if f.File != "" {
+		location = f.File + ":" + location
+	}
+	return fmt.Sprintf("%s (%s) [%04d]", f.Name, location, f.Offset)
+}
+
+// maxTraceFrames StackTrace 最多输出的帧数, 超出时省略中间部分(如无限递归)
+const maxTraceFrames = 20
+
+// RuntimeError 虚拟机运行时错误
+type RuntimeError struct {
+	Message string       // 错误信息
+	Op      code.Opcode  // 出错的指令
+	Stack   []StackFrame // 调用栈, 第一帧为出错位置
+	Err     error        // 原始错误
+}
+
+func (e *RuntimeError) Error() string {
+	if len(e.Stack) == 0 || !e.Stack[0].Pos.IsValid() {
+		return e.Message
+	}
+	top := e.Stack[0]
+	if top.File != "" {
+		return fmt.Sprintf("%s:%s: %s", top.File, top.Pos, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", top.Pos, e.Message)
+}
+
+func (e *RuntimeError) Unwrap() error { return e.Err }
+
+// StackTrace 格式化输出错误信息及调用栈
+func (e *RuntimeError) StackTrace() string {
+	b := strings.Builder{}
+	b.WriteString(e.Error())
+	if def, err := code.FindDefinitionByOp(byte(e.Op)); err == nil {
+		b.WriteString(" (" + def.Name + ")")
+	}
+	for i, frame := range e.Stack {
+		if len(e.Stack) > maxTraceFrames && i == maxTraceFrames/2 {
+			_, _ = fmt.Fprintf(&b, "\n\t... %d frames omitted ...", len(e.Stack)-maxTraceFrames)
+		}
+		if len(e.Stack) > maxTraceFrames && i >= maxTraceFrames/2 && i < len(e.Stack)-maxTraceFrames/2 {
+			continue
+		}
+		b.WriteString("\n\tat " + frame.String())
+	}
+	return b.String()
+}
+
+// newRuntimeError 遍历调用栈生成运行时错误
+func (v *VM) newRuntimeError(err error) *RuntimeError {
+	if re, ok := err.(*RuntimeError); ok {
+		return re
+	}
+	e := &RuntimeError{Message: err.Error(), Err: err}
+	for i := v.framesIndex - 1; i >= 0; i-- {
+		frame := v.frames[i]
+		offset := instructionStart(frame.Instructions(), frame.ip)
+		if i == v.framesIndex-1 && offset < len(frame.Instructions()) {
+			e.Op = code.Opcode(frame.Instructions()[offset])
+		}
+		pos, _ := frame.cl.Fn.Positions.Lookup(offset)
+		e.Stack = append(e.Stack, StackFrame{
+			Name:   frame.name(),
+			Offset: offset,
+			File:   v.file,
+			Pos:    pos,
+		})
+	}
+	return e
+}
+
+// instructionStart 查找 ip 所在指令的起始偏移量
+func instructionStart(ins code.Instructions, ip int) int {
+	if ip <= 0 {
+		return 0
+	}
+	for i := 0; i < len(ins); {
+		def, err := code.FindDefinitionByOp(ins[i])
+		if err != nil {
+			return ip
+		}
+		next := i + 1
+		for _, w := range def.OperandWidths {
+			next += w
+		}
+		if ip < next {
+			return i
+		}
+		i = next
+	}
+	return ip
+}
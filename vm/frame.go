@@ -15,6 +15,13 @@ func (f *Frame) Instructions() code.Instructions {
 	return f.cl.Fn.Instructions
 }
 
+func (f *Frame) name() string {
+	if f.cl.Fn.Name == "" {
+		return "<anonymous>"
+	}
+	return f.cl.Fn.Name
+}
+
 func NewFrame(cl *compiler.Closure, basePointer int) *Frame {
 	return &Frame{
 		cl:          cl,
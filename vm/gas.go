@@ -0,0 +1,56 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/songzhibin97/mini-compiler/code"
+)
+
+var ErrBudgetExceeded = errors.New("gas budget exceeded")
+
+// CostTable 每条指令消耗的 gas, 以操作码为下标
+type CostTable [256]uint64
+
+// DefaultCostTable 默认消耗: 普通指令为 1, 调用与分配内存的指令更高
+func DefaultCostTable() *CostTable {
+	t := &CostTable{}
+	for i := range t {
+		t[i] = 1
+	}
+	t[code.OpCall] = 10
+	t[code.OpTailCall] = 10
+	t[code.OpClosure] = 5
+	t[code.OpArray] = 5
+	t[code.OpMap] = 5
+	t[code.OpSetIndex] = 2
+	return t
+}
+
+// WithBudget 开启 gas 计量, 消耗超过 budget 时 Run 返回 ErrBudgetExceeded
+func WithBudget(budget uint64) Option {
+	return func(c *config) {
+		c.budget = budget
+	}
+}
+
+// WithCostTable 设置各指令的 gas 消耗, 默认 DefaultCostTable, 仅在 WithBudget 开启时生效
+func WithCostTable(costs *CostTable) Option {
+	return func(c *config) {
+		c.costs = costs
+	}
+}
+
+// GasUsed 已消耗的 gas
+func (v *VM) GasUsed() uint64 {
+	return v.gasUsed
+}
+
+// consumeGas 扣除指令消耗的 gas
+func (v *VM) consumeGas(op code.Opcode) error {
+	v.gasUsed += v.costs[op]
+	if v.gasUsed > v.budget {
+		return fmt.Errorf("%w: used %d of %d", ErrBudgetExceeded, v.gasUsed, v.budget)
+	}
+	return nil
+}
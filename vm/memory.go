@@ -0,0 +1,73 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/songzhibin97/mini-interpreter/object"
+)
+
+var ErrMemoryLimit = errors.New("memory limit exceeded")
+
+// 各类对象的近似内存占用(字节)
+const (
+	sizeObject   = 16 // object.Object 接口值
+	sizeArray    = 48 // *object.Array 及切片头
+	sizeMap      = 48 // *object.Map 及 map 头
+	sizeMapEntry = 80 // MapKey + HashValue 以及桶的开销
+	sizeString   = 32 // *object.Stringer 及字符串头
+	sizeClosure  = 48 // *compiler.Closure 及切片头
+	sizeUpvalue  = 40 // *compiler.Upvalue 及 Ctx 中的指针
+)
+
+// WithMemoryLimit 限制脚本分配的内存(数组/map/字符串拼接/闭包以及内置函数返回的数组/map/字符串),
+// 超出时 Run 返回 ErrMemoryLimit
+// 只统计累计分配量, 不会因为对象被回收而减少
+func WithMemoryLimit(limit uint64) Option {
+	return func(c *config) {
+		c.memoryLimit = limit
+	}
+}
+
+// MemoryUsed 已分配的内存(近似值)
+func (v *VM) MemoryUsed() uint64 {
+	return v.memoryUsed
+}
+
+// allocate 在分配之前记录内存占用, 超过限制时返回错误
+func (v *VM) allocate(size uint64) error {
+	v.memoryUsed += size
+	if v.memoryLimit > 0 && v.memoryUsed > v.memoryLimit {
+		return fmt.Errorf("%w: allocated %d of %d bytes", ErrMemoryLimit, v.memoryUsed, v.memoryLimit)
+	}
+	return nil
+}
+
+// sizeOf 估算内置函数返回的对象占用的内存, 包括数组/map 中的元素
+// seen 中的对象(如内置函数的参数)已经统计过, 同时避免循环引用导致无限递归
+func sizeOf(obj object.Object, seen map[object.Object]bool) uint64 {
+	switch obj.(type) {
+	case *object.Stringer, *object.Array, *object.Map:
+		if seen[obj] {
+			return 0
+		}
+		seen[obj] = true
+	}
+	switch obj := obj.(type) {
+	case *object.Stringer:
+		return uint64(sizeString + len(obj.Value))
+	case *object.Array:
+		size := uint64(sizeArray + sizeObject*len(obj.Elements))
+		for _, element := range obj.Elements {
+			size += sizeOf(element, seen)
+		}
+		return size
+	case *object.Map:
+		size := uint64(sizeMap + sizeMapEntry*len(obj.Elements))
+		for _, pair := range obj.Elements {
+			size += sizeOf(pair.Key, seen) + sizeOf(pair.Value, seen)
+		}
+		return size
+	}
+	return 0
+}
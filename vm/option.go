@@ -0,0 +1,113 @@
+package vm
+
+import (
+	"io"
+	"os"
+
+	"github.com/songzhibin97/mini-compiler/compiler"
+)
+
+// config 虚拟机容量配置
+type config struct {
+	stackSize   int
+	frameSize   int
+	globalsSize int
+
+	budget uint64     // gas 预算, 0 表示不计量
+	costs  *CostTable // 各指令的 gas 消耗
+
+	memoryLimit uint64 // 内存上限(字节), 0 表示不限制
+
+	builtins *compiler.Builtins // 内置函数注册表
+
+	checked bool // 整数溢出检查
+
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// Option 虚拟机配置项
+type Option func(c *config)
+
+// WithStackSize 设置操作数栈大小, 默认 StackSize
+func WithStackSize(size int) Option {
+	return func(c *config) {
+		if size > 0 {
+			c.stackSize = size
+		}
+	}
+}
+
+// WithFrameSize 设置调用栈深度, 默认 FrameSize
+func WithFrameSize(size int) Option {
+	return func(c *config) {
+		if size > 0 {
+			c.frameSize = size
+		}
+	}
+}
+
+// WithGlobalsSize 设置全局变量数量, 默认 GlobalsSize
+// 使用 NewVMWithGlobals 时以传入的 globals 长度为准
+func WithGlobalsSize(size int) Option {
+	return func(c *config) {
+		if size > 0 {
+			c.globalsSize = size
+		}
+	}
+}
+
+// WithBuiltins 设置内置函数注册表, 需与编译时使用的注册表一致, 默认 compiler.DefaultBuiltins()
+func WithBuiltins(builtins *compiler.Builtins) Option {
+	return func(c *config) {
+		if builtins != nil {
+			c.builtins = builtins
+		}
+	}
+}
+
+// WithStdin 设置内置函数使用的标准输入, 默认 os.Stdin
+func WithStdin(r io.Reader) Option {
+	return func(c *config) {
+		if r != nil {
+			c.stdin = r
+		}
+	}
+}
+
+// WithStdout 设置内置函数(如 print)使用的标准输出, 默认 os.Stdout
+func WithStdout(w io.Writer) Option {
+	return func(c *config) {
+		if w != nil {
+			c.stdout = w
+		}
+	}
+}
+
+// WithStderr 设置内置函数使用的标准错误输出, 默认 os.Stderr
+func WithStderr(w io.Writer) Option {
+	return func(c *config) {
+		if w != nil {
+			c.stderr = w
+		}
+	}
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{
+		stackSize:   StackSize,
+		frameSize:   FrameSize,
+		globalsSize: GlobalsSize,
+		stdin:       os.Stdin,
+		stdout:      os.Stdout,
+		stderr:      os.Stderr,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.builtins == nil {
+		c.builtins = compiler.DefaultBuiltins()
+	}
+	return c
+}
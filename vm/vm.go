@@ -1,17 +1,20 @@
 package vm
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"math"
 
 	"github.com/songzhibin97/mini-compiler/code"
 	"github.com/songzhibin97/mini-compiler/compiler"
 	"github.com/songzhibin97/mini-interpreter/object"
 )
 
-var True = &object.Boolean{Value: true}
-var False = &object.Boolean{Value: false}
-var Nil = &object.Nil{}
+var True = compiler.True
+var False = compiler.False
+var Nil = compiler.Nil
 
 const (
 	StackSize   = 1 << 11
@@ -19,10 +22,19 @@ const (
 	FrameSize   = 1 << 11
 )
 
-var ErrStackOverflow = errors.New("stack overflow")
+var (
+	ErrStackOverflow   = errors.New("stack overflow")
+	ErrFrameOverflow   = errors.New("frame overflow: maximum call depth exceeded")
+	ErrGlobalsOverflow = errors.New("globals overflow: too many global variables")
+	ErrReturnOutside   = errors.New("return outside function")
+
+	ErrDivisionByZero = compiler.ErrDivisionByZero
+	ErrNegativeShift  = compiler.ErrNegativeShift
+)
 
 type VM struct {
 	constants []object.Object
+	file      string // 源文件名
 
 	stack []object.Object
 	sp    int // Stack Pointer 始终指向下一个位置, 栈顶应该是 stack[sp-1]
@@ -31,15 +43,45 @@ type VM struct {
 
 	frames      []*Frame
 	framesIndex int
+
+	openUpvalues []openUpvalue // 仍指向栈上槽位的 upvalue
+
+	costs   *CostTable // gas 消耗表, nil 表示不计量
+	budget  uint64
+	gasUsed uint64
+
+	ctx  context.Context // RunContext 传入的 ctx
+	done <-chan struct{} // ctx.Done(), 为 nil 时不检查
+
+	memoryLimit uint64
+	memoryUsed  uint64
+
+	builtins   *compiler.Builtins
+	builtinErr error // 字节码引用的内置函数与注册表不一致, Run/Call 直接返回
+
+	checked bool // 是否检查整数溢出
+
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+type openUpvalue struct {
+	slot int
+	up   *compiler.Upvalue
 }
 
 func (v *VM) curFrame() *Frame {
 	return v.frames[v.framesIndex-1]
 }
 
-func (v *VM) pushFrame(frame *Frame) {
+func (v *VM) pushFrame(frame *Frame) error {
+	if v.framesIndex >= len(v.frames) {
+		return ErrFrameOverflow
+	}
 	v.frames[v.framesIndex] = frame
 	v.framesIndex++
+	return nil
 }
 
 func (v *VM) popFrame() *Frame {
@@ -48,7 +90,7 @@ func (v *VM) popFrame() *Frame {
 }
 
 func (v *VM) push(o object.Object) error {
-	if v.sp >= StackSize {
+	if v.sp >= len(v.stack) {
 		return ErrStackOverflow
 	}
 	v.stack[v.sp] = o
@@ -70,6 +112,9 @@ func (v *VM) executeArithmeticOperation(op code.Opcode) error {
 	if left.Type() == object.INT && right.Type() == object.INT {
 		return v.executeArithmeticIntegerOperation(op, left, right)
 	}
+	if lv, rv, ok := compiler.FloatOperands(left, right); ok {
+		return v.executeArithmeticFloatOperation(op, lv, rv, left, right)
+	}
 	if left.Type() == object.String && right.Type() == object.String {
 		return v.executeArithmeticStringOperation(op, left, right)
 	}
@@ -87,18 +132,70 @@ func (v *VM) executeArithmeticIntegerOperation(op code.Opcode, left, right objec
 	case code.OpMul:
 		result = lv * rv
 	case code.OpQuo:
+		if rv == 0 {
+			return ErrDivisionByZero
+		}
 		result = lv / rv
+	case code.OpRem:
+		if rv == 0 {
+			return ErrDivisionByZero
+		}
+		result = lv % rv
+	case code.OpAnd:
+		result = lv & rv
+	case code.OpOr:
+		result = lv | rv
+	case code.OpXor:
+		result = lv ^ rv
+	case code.OpShl:
+		if rv < 0 {
+			return ErrNegativeShift
+		}
+		result = lv << uint64(rv)
+	case code.OpShr:
+		if rv < 0 {
+			return ErrNegativeShift
+		}
+		result = lv >> uint64(rv)
 	default:
 		return fmt.Errorf("unknown integer operator: %d", op)
 	}
+	if v.checked && integerOverflows(op, lv, rv, result) {
+		return ErrIntegerOverflow
+	}
 	return v.push(&object.Integer{Value: result})
 }
 
+// executeArithmeticFloatOperation 浮点数运算, 整数操作数已提升为 float64
+// 遵循 IEEE 754, 除零得到 ±Inf 或 NaN, 取模与 math.Mod 一致
+func (v *VM) executeArithmeticFloatOperation(op code.Opcode, lv, rv float64, left, right object.Object) error {
+	var result float64
+	switch op {
+	case code.OpAdd:
+		result = lv + rv
+	case code.OpSub:
+		result = lv - rv
+	case code.OpMul:
+		result = lv * rv
+	case code.OpQuo:
+		result = lv / rv
+	case code.OpRem:
+		result = math.Mod(lv, rv)
+	default:
+		return fmt.Errorf("unsupported types for operation %s %s", left.Type(), right.Type())
+	}
+	return v.push(&compiler.Float{Value: result})
+}
+
 func (v *VM) executeArithmeticStringOperation(op code.Opcode, left, right object.Object) error {
 	lv, rv := left.(*object.Stringer).Value, right.(*object.Stringer).Value
 	var result string
 	switch op {
 	case code.OpAdd:
+		err := v.allocate(uint64(sizeString + len(lv) + len(rv)))
+		if err != nil {
+			return err
+		}
 		result = lv + rv
 	default:
 		return fmt.Errorf("unknown integer operator: %d", op)
@@ -141,17 +238,53 @@ func (v *VM) executeMapIndex(mp, index object.Object) error {
 	}
 }
 
+func (v *VM) executeSetIndexOperation(left, index, val object.Object) error {
+	switch left := left.(type) {
+	case *object.Array:
+		idx, ok := index.(*object.Integer)
+		if !ok {
+			return fmt.Errorf("array index must be %s, got %s", object.INT, index.Type())
+		}
+		if idx.Value < 0 || idx.Value > int64(len(left.Elements)-1) {
+			return fmt.Errorf("index out of range [%d] with length %d", idx.Value, len(left.Elements))
+		}
+		left.Elements[idx.Value] = val
+		return nil
+	case *object.Map:
+		key, ok := index.(object.HashAble)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", index.Type())
+		}
+		if _, ok := left.Elements[key.MapKey()]; !ok {
+			err := v.allocate(sizeMapEntry)
+			if err != nil {
+				return err
+			}
+		}
+		left.Elements[key.MapKey()] = object.HashValue{Key: index, Value: val}
+		return nil
+	default:
+		return fmt.Errorf("index assignment not supported: %s", left.Type())
+	}
+}
+
 func (v *VM) executeComparisonOperation(op code.Opcode) error {
 	right := v.pop()
 	left := v.pop()
 	if left.Type() == object.INT && right.Type() == object.INT {
 		return v.executeComparisonIntegerOperation(op, left, right)
 	}
+	if lv, rv, ok := compiler.FloatOperands(left, right); ok {
+		return v.executeComparisonFloatOperation(op, lv, rv)
+	}
+	if left.Type() == object.String && right.Type() == object.String && op != code.OpEQL && op != code.OpNEQ {
+		return v.executeComparisonStringOperation(op, left, right)
+	}
 	switch op {
 	case code.OpEQL:
-		return v.push(translationBooleanObject(left == right))
+		return v.push(translationBooleanObject(compiler.Equal(left, right)))
 	case code.OpNEQ:
-		return v.push(translationBooleanObject(left != right))
+		return v.push(translationBooleanObject(!compiler.Equal(left, right)))
 	default:
 		return fmt.Errorf("unknown operator %s %s", left.Type(), right.Type())
 	}
@@ -166,6 +299,48 @@ func (v *VM) executeComparisonIntegerOperation(op code.Opcode, left, right objec
 		return v.push(translationBooleanObject(lv != rv))
 	case code.OpGTR:
 		return v.push(translationBooleanObject(lv > rv))
+	case code.OpLSS:
+		return v.push(translationBooleanObject(lv < rv))
+	case code.OpLEQ:
+		return v.push(translationBooleanObject(lv <= rv))
+	case code.OpGEQ:
+		return v.push(translationBooleanObject(lv >= rv))
+	default:
+		return fmt.Errorf("unknown operator: %d", op)
+	}
+}
+
+func (v *VM) executeComparisonFloatOperation(op code.Opcode, lv, rv float64) error {
+	switch op {
+	case code.OpEQL:
+		return v.push(translationBooleanObject(lv == rv))
+	case code.OpNEQ:
+		return v.push(translationBooleanObject(lv != rv))
+	case code.OpGTR:
+		return v.push(translationBooleanObject(lv > rv))
+	case code.OpLSS:
+		return v.push(translationBooleanObject(lv < rv))
+	case code.OpLEQ:
+		return v.push(translationBooleanObject(lv <= rv))
+	case code.OpGEQ:
+		return v.push(translationBooleanObject(lv >= rv))
+	default:
+		return fmt.Errorf("unknown operator: %d", op)
+	}
+}
+
+// executeComparisonStringOperation 字符串按字典序比较
+func (v *VM) executeComparisonStringOperation(op code.Opcode, left, right object.Object) error {
+	lv, rv := left.(*object.Stringer).Value, right.(*object.Stringer).Value
+	switch op {
+	case code.OpGTR:
+		return v.push(translationBooleanObject(lv > rv))
+	case code.OpLSS:
+		return v.push(translationBooleanObject(lv < rv))
+	case code.OpLEQ:
+		return v.push(translationBooleanObject(lv <= rv))
+	case code.OpGEQ:
+		return v.push(translationBooleanObject(lv >= rv))
 	default:
 		return fmt.Errorf("unknown operator: %d", op)
 	}
@@ -187,10 +362,25 @@ func (v *VM) executeBangOperation() error {
 
 func (v *VM) executeMinusOperation() error {
 	op := v.pop()
+	if f, ok := op.(*compiler.Float); ok {
+		return v.push(&compiler.Float{Value: -f.Value})
+	}
 	if op.Type() != object.INT {
 		return fmt.Errorf("unsupported type for minus %s", op.Type())
 	}
-	return v.push(&object.Integer{Value: -op.(*object.Integer).Value})
+	value := op.(*object.Integer).Value
+	if v.checked && value == math.MinInt64 {
+		return ErrIntegerOverflow
+	}
+	return v.push(&object.Integer{Value: -value})
+}
+
+func (v *VM) executeBitNotOperation() error {
+	op := v.pop()
+	if op.Type() != object.INT {
+		return fmt.Errorf("unsupported type for bitwise not %s", op.Type())
+	}
+	return v.push(&object.Integer{Value: ^op.(*object.Integer).Value})
 }
 
 func (v *VM) isTrue(obj object.Object) bool {
@@ -209,8 +399,10 @@ func (v *VM) executeCall(args int) error {
 	switch caller := call.(type) {
 	case *compiler.Closure:
 		return v.callClosure(caller, args)
-	case *object.Builtin:
+	case *compiler.Builtin:
 		return v.callBuiltin(caller, args)
+	case *object.Builtin:
+		return v.callObjectBuiltin(caller, args)
 	default:
 		return fmt.Errorf("calling non-function and non-built-in")
 	}
@@ -222,14 +414,73 @@ func (v *VM) callClosure(cl *compiler.Closure, args int) error {
 			cl.Fn.NumParameters, args)
 	}
 	frame := NewFrame(cl, v.sp-args)
-	v.pushFrame(frame)
+	if frame.basePointer+cl.Fn.NumLocals > len(v.stack) {
+		return ErrStackOverflow
+	}
+	err := v.pushFrame(frame)
+	if err != nil {
+		return err
+	}
 
 	v.sp = frame.basePointer + cl.Fn.NumLocals
 
 	return nil
 }
 
-func (v *VM) callBuiltin(fn *object.Builtin, numArgs int) error {
+// tailCall 尾调用, 被调用的闭包复用当前栈帧
+func (v *VM) tailCall(args int) error {
+	cl, ok := v.stack[v.sp-1-args].(*compiler.Closure)
+	if !ok {
+		return v.executeCall(args)
+	}
+	if args != cl.Fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
+			cl.Fn.NumParameters, args)
+	}
+	frame := v.curFrame()
+	if frame.basePointer+cl.Fn.NumLocals > len(v.stack) {
+		return ErrStackOverflow
+	}
+	// 当前帧的局部变量即将被覆盖, 先关闭指向它们的 upvalue
+	v.closeUpvalues(frame.basePointer)
+	copy(v.stack[frame.basePointer-1:], v.stack[v.sp-1-args:v.sp])
+	frame.cl = cl
+	frame.ip = -1
+	v.sp = frame.basePointer + cl.Fn.NumLocals
+	return nil
+}
+
+func (v *VM) callBuiltin(fn *compiler.Builtin, numArgs int) error {
+	if fn.Arity != compiler.Variadic && numArgs != fn.Arity {
+		return fmt.Errorf("wrong number of arguments to %s: want=%d, got=%d",
+			fn.Name, fn.Arity, numArgs)
+	}
+	args := v.stack[v.sp-numArgs : v.sp]
+	// 内置函数回调脚本时在 sp 之上压栈, 不会覆盖 args
+	result, err := fn.Fn(v, args...)
+	if err != nil {
+		return err
+	}
+	// 内置函数(包括宿主函数)创建的数组/map/字符串同样计入内存, 原样返回的参数不重复计算
+	seen := make(map[object.Object]bool, len(args))
+	for _, arg := range args {
+		seen[arg] = true
+	}
+	err = v.allocate(sizeOf(result, seen))
+	if err != nil {
+		return err
+	}
+	v.sp = v.sp - numArgs - 1
+
+	if result != nil {
+		return v.push(result)
+	} else {
+		return v.push(Nil)
+	}
+}
+
+// callObjectBuiltin 调用宿主直接提供的 object.Builtin
+func (v *VM) callObjectBuiltin(fn *object.Builtin, numArgs int) error {
 	args := v.stack[v.sp-numArgs : v.sp]
 	result := fn.Fn(args...)
 	v.sp = v.sp - numArgs - 1
@@ -241,15 +492,23 @@ func (v *VM) callBuiltin(fn *object.Builtin, numArgs int) error {
 	}
 }
 
-func (v *VM) newArray(start, end int) object.Object {
+func (v *VM) newArray(start, end int) (object.Object, error) {
+	err := v.allocate(uint64(sizeArray + sizeObject*(end-start)))
+	if err != nil {
+		return Nil, err
+	}
 	elems := make([]object.Object, end-start)
 	for i := start; i < end; i++ {
 		elems[i-start] = v.stack[i]
 	}
-	return &object.Array{Elements: elems}
+	return &object.Array{Elements: elems}, nil
 }
 
 func (v *VM) newMap(start, end int) (object.Object, error) {
+	err := v.allocate(uint64(sizeMap + sizeMapEntry*(end-start)/2))
+	if err != nil {
+		return Nil, err
+	}
 	mp := make(map[object.MapKey]object.HashValue, end-start)
 	for i := start; i < end; i += 2 {
 		key := v.stack[i]
@@ -272,16 +531,55 @@ func (v *VM) pushClosure(idx int, countCtx int) error {
 	if !ok {
 		return fmt.Errorf("not a function: %+v", constant)
 	}
-	ctxs := make([]object.Object, countCtx)
+	err := v.allocate(uint64(sizeClosure + sizeUpvalue*countCtx))
+	if err != nil {
+		return err
+	}
+	ctxs := make([]*compiler.Upvalue, countCtx)
 	for i := 0; i < countCtx; i++ {
-		ctxs[i] = v.stack[v.sp-countCtx+i]
+		switch o := v.stack[v.sp-countCtx+i].(type) {
+		case *compiler.Upvalue:
+			ctxs[i] = o
+		default:
+			// OpCurrClosure 等按值捕获
+			ctxs[i] = compiler.NewClosedUpvalue(o)
+		}
 	}
 	v.sp -= countCtx
 	closure := &compiler.Closure{Fn: fn, Ctx: ctxs}
 	return v.push(closure)
 }
 
+// captureUpvalue 获取指向栈上槽位的 upvalue, 同一槽位只会创建一个
+func (v *VM) captureUpvalue(slot int) *compiler.Upvalue {
+	for _, open := range v.openUpvalues {
+		if open.slot == slot {
+			return open.up
+		}
+	}
+	up := &compiler.Upvalue{Ref: &v.stack[slot]}
+	v.openUpvalues = append(v.openUpvalues, openUpvalue{slot: slot, up: up})
+	return up
+}
+
+// closeUpvalues 关闭所有指向 base 及以上槽位的 upvalue, 在函数返回时调用
+func (v *VM) closeUpvalues(base int) {
+	n := 0
+	for _, open := range v.openUpvalues {
+		if open.slot >= base {
+			open.up.Close()
+			continue
+		}
+		v.openUpvalues[n] = open
+		n++
+	}
+	v.openUpvalues = v.openUpvalues[:n]
+}
+
 func (v *VM) LastPoppedStackElem() object.Object {
+	if v.sp >= len(v.stack) {
+		return nil
+	}
 	return v.stack[v.sp]
 }
 
@@ -294,16 +592,28 @@ func (v *VM) Top() object.Object {
 }
 
 func defaultVmHandler(v *VM) error {
+	return v.execute(0)
+}
+
+// execute 执行指令, 直到调用栈深度回到 depth(嵌套调用的函数返回)或主函数执行完毕
+func (v *VM) execute(depth int) error {
 	var (
 		instructions code.Instructions
 		op           code.Opcode
 	)
-	for v.curFrame().ip < len(v.curFrame().Instructions())-1 {
+	for v.framesIndex > depth && v.curFrame().ip < len(v.curFrame().Instructions())-1 {
 		v.curFrame().ip++
 
 		instructions = v.curFrame().Instructions()
 		op = code.Opcode(instructions[v.curFrame().ip]) // 获取指令
 
+		if v.costs != nil {
+			err := v.consumeGas(op)
+			if err != nil {
+				return err
+			}
+		}
+
 		// 处理指令
 		switch op {
 
@@ -320,11 +630,13 @@ func defaultVmHandler(v *VM) error {
 			ln := int(code.ReadUint16(instructions[v.curFrame().ip+1:]))
 			v.curFrame().ip += 2
 
-			array := v.newArray(v.sp-ln, v.sp)
+			array, err := v.newArray(v.sp-ln, v.sp)
+			if err != nil {
+				return err
+			}
 			v.sp -= ln
 
-			err := v.push(array)
-
+			err = v.push(array)
 			if err != nil {
 				return err
 			}
@@ -352,7 +664,17 @@ func defaultVmHandler(v *VM) error {
 				return err
 			}
 
-		case code.OpAdd, code.OpSub, code.OpMul, code.OpQuo:
+		case code.OpSetIndex:
+			val := v.pop()
+			index := v.pop()
+			left := v.pop()
+			err := v.executeSetIndexOperation(left, index, val)
+			if err != nil {
+				return err
+			}
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpQuo,
+			code.OpRem, code.OpAnd, code.OpOr, code.OpXor, code.OpShl, code.OpShr:
 			err := v.executeArithmeticOperation(op)
 			if err != nil {
 				return err
@@ -374,14 +696,36 @@ func defaultVmHandler(v *VM) error {
 			args := code.ReadUint8(instructions[v.curFrame().ip+1:])
 			v.curFrame().ip += 1
 
-			err := v.executeCall(int(args))
+			err := v.checkContext()
+			if err != nil {
+				return err
+			}
+			err = v.executeCall(int(args))
+			if err != nil {
+				return err
+			}
+
+		case code.OpTailCall:
+			args := code.ReadUint8(instructions[v.curFrame().ip+1:])
+			v.curFrame().ip += 1
+
+			err := v.checkContext()
+			if err != nil {
+				return err
+			}
+			err = v.tailCall(int(args))
 			if err != nil {
 				return err
 			}
 
 		case code.OpReturnValue:
+			if v.framesIndex <= 1 {
+				// main 不能返回, 否则 sp 变为 -1
+				return ErrReturnOutside
+			}
 			val := v.pop()
 			frame := v.popFrame()
+			v.closeUpvalues(frame.basePointer)
 			v.sp = frame.basePointer - 1
 			err := v.push(val)
 			if err != nil {
@@ -389,7 +733,11 @@ func defaultVmHandler(v *VM) error {
 			}
 
 		case code.OpReturn:
+			if v.framesIndex <= 1 {
+				return ErrReturnOutside
+			}
 			frame := v.popFrame()
+			v.closeUpvalues(frame.basePointer)
 			v.sp = frame.basePointer - 1
 			err := v.push(Nil)
 			if err != nil {
@@ -400,7 +748,7 @@ func defaultVmHandler(v *VM) error {
 			idx := code.ReadUint8(instructions[v.curFrame().ip+1:])
 			v.curFrame().ip += 1
 
-			builtin := compiler.GetBuiltinByIndex(int(idx))
+			builtin := v.builtins.Get(int(idx))
 			if builtin == nil {
 				return errors.New("invalid built-in function index")
 			}
@@ -414,6 +762,9 @@ func defaultVmHandler(v *VM) error {
 			index := code.ReadUint16(instructions[v.curFrame().ip+1:])
 			v.curFrame().ip += 2
 
+			if int(index) >= len(v.globals) {
+				return ErrGlobalsOverflow
+			}
 			v.globals[index] = v.pop()
 
 		case code.OpGetGlobal:
@@ -421,6 +772,9 @@ func defaultVmHandler(v *VM) error {
 			index := code.ReadUint16(instructions[v.curFrame().ip+1:])
 			v.curFrame().ip += 2
 
+			if int(index) >= len(v.globals) {
+				return ErrGlobalsOverflow
+			}
 			err := v.push(v.globals[index])
 			if err != nil {
 				return err
@@ -441,7 +795,7 @@ func defaultVmHandler(v *VM) error {
 				return err
 			}
 
-		case code.OpEQL, code.OpNEQ, code.OpGTR:
+		case code.OpEQL, code.OpNEQ, code.OpGTR, code.OpLSS, code.OpLEQ, code.OpGEQ:
 			err := v.executeComparisonOperation(op)
 			if err != nil {
 				return err
@@ -459,9 +813,22 @@ func defaultVmHandler(v *VM) error {
 				return err
 			}
 
+		case code.OpBitNot:
+			err := v.executeBitNotOperation()
+			if err != nil {
+				return err
+			}
+
 		case code.OpJump:
 			// 读取位置, 将i指向下一个要执行指令的位置
 			pos := int(code.ReadUint16(instructions[v.curFrame().ip+1:]))
+			if pos <= v.curFrame().ip {
+				// 向后跳转(循环)时检查是否被取消
+				err := v.checkContext()
+				if err != nil {
+					return err
+				}
+			}
 			v.curFrame().ip = pos - 1
 
 		case code.OpClosure:
@@ -475,6 +842,27 @@ func defaultVmHandler(v *VM) error {
 			}
 
 		case code.OpContext:
+			idx := code.ReadUint8(instructions[v.curFrame().ip+1:])
+			v.curFrame().ip += 1
+			err := v.push(*v.curFrame().cl.Ctx[idx].Ref)
+			if err != nil {
+				return err
+			}
+
+		case code.OpSetContext:
+			idx := code.ReadUint8(instructions[v.curFrame().ip+1:])
+			v.curFrame().ip += 1
+			*v.curFrame().cl.Ctx[idx].Ref = v.pop()
+
+		case code.OpCaptureLocal:
+			idx := code.ReadUint8(instructions[v.curFrame().ip+1:])
+			v.curFrame().ip += 1
+			err := v.push(v.captureUpvalue(v.curFrame().basePointer + int(idx)))
+			if err != nil {
+				return err
+			}
+
+		case code.OpCaptureContext:
 			idx := code.ReadUint8(instructions[v.curFrame().ip+1:])
 			v.curFrame().ip += 1
 			err := v.push(v.curFrame().cl.Ctx[idx])
@@ -494,7 +882,23 @@ func defaultVmHandler(v *VM) error {
 			v.curFrame().ip += 2
 			c := v.pop()
 			if !v.isTrue(c) {
+				if pos <= v.curFrame().ip {
+					err := v.checkContext()
+					if err != nil {
+						return err
+					}
+				}
+				v.curFrame().ip = pos - 1
+			}
+
+		case code.OpJumpNotTrueOrPop, code.OpJumpTrueOrPop:
+			// 短路求值, 能决定结果的操作数留在栈上
+			pos := int(code.ReadUint16(instructions[v.curFrame().ip+1:]))
+			v.curFrame().ip += 2
+			if v.isTrue(v.Top()) == (op == code.OpJumpTrueOrPop) {
 				v.curFrame().ip = pos - 1
+			} else {
+				v.pop()
 			}
 
 		case code.OpNil:
@@ -511,8 +915,101 @@ func defaultVmHandler(v *VM) error {
 }
 
 func (v *VM) Run(handler ...func(vm *VM) error) error {
+	if v.builtinErr != nil {
+		return v.builtinErr
+	}
 	handler = append(handler, defaultVmHandler)
-	return handler[0](v)
+	err := handler[0](v)
+	if err != nil {
+		return v.newRuntimeError(err)
+	}
+	return nil
+}
+
+// Call 调用闭包或内置函数, 在嵌套的指令循环中执行到函数返回并返回结果
+// 可以在 Run 结束后调用脚本返回的闭包, 也可以在内置函数中回调脚本(可重入)
+// 闭包引用了常量池, 只能在使用同一份字节码创建的虚拟机中调用
+// 出错时恢复调用前的栈状态, 返回 *RuntimeError
+func (v *VM) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	if v.builtinErr != nil {
+		return nil, v.builtinErr
+	}
+	sp, depth := v.sp, v.framesIndex
+	err := v.call(fn, args, depth)
+	if err != nil {
+		re := v.newRuntimeError(err)
+		v.closeUpvalues(sp)
+		v.sp, v.framesIndex = sp, depth
+		return nil, re
+	}
+	result := v.pop()
+	v.sp = sp
+	return result, nil
+}
+
+func (v *VM) call(fn object.Object, args []object.Object, depth int) error {
+	err := v.push(fn)
+	if err != nil {
+		return err
+	}
+	for _, arg := range args {
+		err = v.push(arg)
+		if err != nil {
+			return err
+		}
+	}
+	err = v.checkContext()
+	if err != nil {
+		return err
+	}
+	err = v.executeCall(len(args))
+	if err != nil || v.framesIndex == depth {
+		// 内置函数已将结果压栈
+		return err
+	}
+	err = v.execute(depth)
+	if err != nil {
+		return err
+	}
+	if v.framesIndex != depth {
+		return errors.New("function ended without return")
+	}
+	return nil
+}
+
+// Stdin 内置函数使用的标准输入
+func (v *VM) Stdin() io.Reader { return v.stdin }
+
+// Stdout 内置函数使用的标准输出
+func (v *VM) Stdout() io.Writer { return v.stdout }
+
+// Stderr 内置函数使用的标准错误输出
+func (v *VM) Stderr() io.Writer { return v.stderr }
+
+// RunContext 与 Run 相同, ctx 被取消或超时后在下一次向后跳转或函数调用时停止执行
+// 返回的 *RuntimeError 包装了 ctx.Err(), 可通过 errors.Is 判断
+func (v *VM) RunContext(ctx context.Context, handler ...func(vm *VM) error) error {
+	v.ctx, v.done = ctx, ctx.Done()
+	defer func() { v.ctx, v.done = nil, nil }()
+
+	err := v.checkContext()
+	if err != nil {
+		return v.newRuntimeError(err)
+	}
+	return v.Run(handler...)
+}
+
+// checkContext 检查 RunContext 传入的 ctx 是否已结束
+func (v *VM) checkContext() error {
+	if v.done == nil {
+		return nil
+	}
+	select {
+	case <-v.done:
+		return v.ctx.Err()
+	default:
+		return nil
+	}
 }
 
 func translationBooleanObject(input bool) *object.Boolean {
@@ -522,34 +1019,42 @@ func translationBooleanObject(input bool) *object.Boolean {
 	return False
 }
 
-func NewVM(bytecode *compiler.Bytecode) *VM {
-	mainFrame := &compiler.CompiledFunction{Instructions: bytecode.Instructions}
-	frame := make([]*Frame, FrameSize)
-	closure := &compiler.Closure{Fn: mainFrame}
-	frame[0] = NewFrame(closure, 0)
-	return &VM{
-		constants: bytecode.Constants,
-		stack:     make([]object.Object, StackSize), // 初始化栈大小
-		sp:        0,
+// NewVM 创建虚拟机, opts 可调整栈/调用栈/全局变量的容量
+func NewVM(bytecode *compiler.Bytecode, opts ...Option) *VM {
+	cfg := newConfig(opts)
+	return newVM(bytecode, make([]object.Object, cfg.globalsSize), cfg)
+}
 
-		globals:     make([]object.Object, GlobalsSize),
-		frames:      frame,
-		framesIndex: 1,
-	}
+// NewVMWithGlobals 使用已有的全局变量创建虚拟机(REPL 在多次执行间共享全局变量)
+func NewVMWithGlobals(bytecode *compiler.Bytecode, globals []object.Object, opts ...Option) *VM {
+	return newVM(bytecode, globals, newConfig(opts))
 }
 
-func NewVMWithGlobals(bytecode *compiler.Bytecode, globals []object.Object) *VM {
-	mainFrame := &compiler.CompiledFunction{Instructions: bytecode.Instructions}
-	frame := make([]*Frame, FrameSize)
+func newVM(bytecode *compiler.Bytecode, globals []object.Object, cfg *config) *VM {
+	mainFrame := &compiler.CompiledFunction{Name: "main", Instructions: bytecode.Instructions, Positions: bytecode.Positions}
+	frame := make([]*Frame, cfg.frameSize)
 	closure := &compiler.Closure{Fn: mainFrame}
 	frame[0] = NewFrame(closure, 0)
-	return &VM{
+	v := &VM{
 		constants: bytecode.Constants,
-		stack:     make([]object.Object, StackSize), // 初始化栈大小
+		file:      bytecode.File,
+		stack:     make([]object.Object, cfg.stackSize), // 初始化栈大小
 		sp:        0,
 
 		globals:     globals,
 		frames:      frame,
 		framesIndex: 1,
 	}
+	v.memoryLimit = cfg.memoryLimit
+	v.builtins = cfg.builtins
+	v.builtinErr = bytecode.CheckBuiltins(cfg.builtins)
+	v.checked = cfg.checked
+	v.stdin, v.stdout, v.stderr = cfg.stdin, cfg.stdout, cfg.stderr
+	if cfg.budget > 0 {
+		v.budget, v.costs = cfg.budget, cfg.costs
+		if v.costs == nil {
+			v.costs = DefaultCostTable()
+		}
+	}
+	return v
 }
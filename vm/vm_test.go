@@ -1,16 +1,24 @@
 package vm
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
 	"testing"
+	"time"
 
 	"github.com/songzhibin97/mini-interpreter/object"
 
+	"github.com/songzhibin97/mini-compiler/code"
 	"github.com/songzhibin97/mini-compiler/compiler"
+	"github.com/songzhibin97/mini-compiler/token"
 	"github.com/stretchr/testify/assert"
 
-	"github.com/songzhibin97/mini-interpreter/ast"
-	"github.com/songzhibin97/mini-interpreter/lexer"
-	"github.com/songzhibin97/mini-interpreter/parser"
+	"github.com/songzhibin97/mini-compiler/ast"
+	"github.com/songzhibin97/mini-compiler/lexer"
+	"github.com/songzhibin97/mini-compiler/parser"
 )
 
 type vmTestCase struct {
@@ -29,6 +37,8 @@ func testExpectedObject(t *testing.T, expected interface{}, actual object.Object
 	switch expected := expected.(type) {
 	case int:
 		testIntegerObject(t, int64(expected), actual)
+	case float64:
+		testFloatObject(t, expected, actual)
 	case bool:
 		testBooleanObject(t, expected, actual)
 	case string:
@@ -48,6 +58,12 @@ func testIntegerObject(t *testing.T, expected int64, actual object.Object) {
 	assert.Equal(t, result.Value, expected)
 }
 
+func testFloatObject(t *testing.T, expected float64, actual object.Object) {
+	result, ok := actual.(*compiler.Float)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, result.Value, expected)
+}
+
 func testBooleanObject(t *testing.T, expected bool, actual object.Object) {
 	result, ok := actual.(*object.Boolean)
 	assert.Equal(t, ok, true)
@@ -134,8 +150,124 @@ func TestIntegerArithmetic(t *testing.T) {
 			input:    "(-5 + 10) * 2 + -10",
 			expected: 0,
 		},
+		{
+			input:    "7 % 3",
+			expected: 1,
+		},
+		{
+			input:    "-7 % 3",
+			expected: -1,
+		},
+		{
+			input:    "12 & 10",
+			expected: 8,
+		},
+		{
+			input:    "12 | 10",
+			expected: 14,
+		},
+		{
+			input:    "12 ^ 10",
+			expected: 6,
+		},
+		{
+			input:    "1 << 4",
+			expected: 16,
+		},
+		{
+			input:    "-16 >> 2",
+			expected: -4,
+		},
+		{
+			input:    "1 << 64",
+			expected: 0,
+		},
+		{
+			input:    "^0",
+			expected: -1,
+		},
+		{
+			input:    "^5 & 7",
+			expected: 2,
+		},
 	}
 	runVmTests(t, tests)
+
+	errTests := []struct {
+		input    string
+		expected error
+	}{
+		{input: "1 / 0", expected: ErrDivisionByZero},
+		{input: "var a = 0 1 % a", expected: ErrDivisionByZero},
+		{input: "var a = -1 1 << a", expected: ErrNegativeShift},
+		{input: "var a = -1 1 >> a", expected: ErrNegativeShift},
+	}
+	for _, test := range errTests {
+		comp := compiler.NewCompiler()
+		err := comp.Compiler(parse(test.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err = NewVM(comp.Bytecode()).Run()
+		assert.True(t, errors.Is(err, test.expected), test.input)
+	}
+
+	comp := compiler.NewCompiler()
+	err := comp.Compiler(parse(`^"a"`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	assert.EqualError(t, NewVM(comp.Bytecode()).Run(), "1:1: unsupported type for bitwise not STRING")
+}
+
+func TestCheckedArithmetic(t *testing.T) {
+	const min = "(-9223372036854775807 - 1)"
+	tests := []struct {
+		input     string
+		unchecked int64 // 默认模式下回绕的结果
+		overflows bool
+	}{
+		{input: "9223372036854775806 + 1", unchecked: math.MaxInt64},
+		{input: "9223372036854775807 + 1", unchecked: math.MinInt64, overflows: true},
+		{input: min + " + -1", unchecked: math.MaxInt64, overflows: true},
+		{input: min + " - 1", unchecked: math.MaxInt64, overflows: true},
+		{input: "-2 - 9223372036854775807", unchecked: math.MaxInt64, overflows: true},
+		{input: "1 - 9223372036854775807", unchecked: -math.MaxInt64 + 1},
+		{input: "4611686018427387904 * 2", unchecked: math.MinInt64, overflows: true},
+		{input: "-4611686018427387904 * 2", unchecked: math.MinInt64},
+		{input: "-1 * " + min, unchecked: math.MinInt64, overflows: true},
+		{input: min + " * -1", unchecked: math.MinInt64, overflows: true},
+		{input: min + " / -1", unchecked: math.MinInt64, overflows: true},
+		{input: min + " % -1", unchecked: 0},
+		{input: "-" + min, unchecked: math.MinInt64, overflows: true},
+		{input: "-9223372036854775807", unchecked: -math.MaxInt64},
+		{input: "0 * " + min, unchecked: 0},
+	}
+
+	for _, test := range tests {
+		// 溢出的表达式不折叠, 折叠与否结果一致
+		for _, folding := range []bool{false, true} {
+			comp := compiler.NewCompiler()
+			comp.SetConstantFolding(folding)
+			err := comp.Compiler(parse(test.input))
+			if err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+
+			vm := NewVM(comp.Bytecode())
+			assert.NoError(t, vm.Run(), test.input)
+			testIntegerObject(t, test.unchecked, vm.LastPoppedStackElem())
+
+			vm = NewVM(comp.Bytecode(), WithCheckedArithmetic())
+			err = vm.Run()
+			if test.overflows {
+				assert.True(t, errors.Is(err, ErrIntegerOverflow), test.input)
+				continue
+			}
+			assert.NoError(t, err, test.input)
+			testIntegerObject(t, test.unchecked, vm.LastPoppedStackElem())
+		}
+	}
 }
 
 func TestBooleanExpr(t *testing.T) {
@@ -244,6 +376,131 @@ func TestBooleanExpr(t *testing.T) {
 			input:    "!(if (false) { 5 })",
 			expected: true,
 		},
+		{
+			input:    "1 <= 1",
+			expected: true,
+		},
+		{
+			input:    "2 <= 1",
+			expected: false,
+		},
+		{
+			input:    "1 >= 1",
+			expected: true,
+		},
+		{
+			input:    "1 >= 2",
+			expected: false,
+		},
+		{
+			input:    `"a" < "b"`,
+			expected: true,
+		},
+		{
+			input:    `"ab" > "b"`,
+			expected: false,
+		},
+		{
+			input:    `"ab" >= "a"`,
+			expected: true,
+		},
+		{
+			input:    `"b" <= "b"`,
+			expected: true,
+		},
+		{
+			input:    `"" < "a"`,
+			expected: true,
+		},
+		{
+			// 操作数从左到右求值
+			input:    "var n = 0 func next() { n = n + 1 n } next() < next()",
+			expected: true,
+		},
+		{
+			input:    "var n = 0 func next() { n = n + 1 n } next() >= next()",
+			expected: false,
+		},
+	}
+	runVmTests(t, tests)
+
+	comp := compiler.NewCompiler()
+	err := comp.Compiler(parse(`1 < "a"`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	assert.EqualError(t, NewVM(comp.Bytecode()).Run(), "1:3: unknown operator INT STRING")
+}
+
+func TestEquality(t *testing.T) {
+	tests := []vmTestCase{
+		{input: `"a" + "b" == "ab"`, expected: true},
+		{input: `var s = "a" s + "b" != "ab"`, expected: false},
+		{input: `"a" == "b"`, expected: false},
+		{input: `[1, 2] == [1, 2]`, expected: true},
+		{input: `[1, 2] == [1, 2, 3]`, expected: false},
+		{input: `[1, [2, "x"]] == [1, [2, "x"]]`, expected: true},
+		{input: `[1, [2, "x"]] != [1, [2, "y"]]`, expected: true},
+		{input: `[1, 2.0] == [1.0, 2]`, expected: true},
+		{input: `{"a": 1} == {"a": 1}`, expected: true},
+		{input: `{"a": 1, "b": [1]} == {"b": [1], "a": 1}`, expected: true},
+		{input: `{"a": 1} == {"a": 2}`, expected: false},
+		{input: `{"a": 1} == {"b": 1}`, expected: false},
+		{input: `{"a": 1} == {"a": 1, "b": 2}`, expected: false},
+		{input: `[] == {}`, expected: false},
+		{input: `"1" == 1`, expected: false},
+		{input: `[if (false) { 1 }] == [if (false) { 2 }]`, expected: true},
+		{input: `[if (false) { 1 }] == [false]`, expected: false},
+		// NaN 与任何值都不相等, 包括数组/字典中的同一个 NaN
+		{input: `var z = 0.0 var n = z / z n == n`, expected: false},
+		{input: `var z = 0.0 var n = z / z var a = [n] var b = [n] a == b`, expected: false},
+		{input: `var z = 0.0 var n = z / z var a = {"a": n} var b = {"a": n} a != b`, expected: true},
+		{input: `func f() { 1 } f == f`, expected: true},
+		{input: `func mk() { func g() { 1 } } mk() == mk()`, expected: false},
+		{
+			// 循环引用
+			input:    `var a = [1, 0] a[1] = a var b = [1, 0] b[1] = b a == b`,
+			expected: true,
+		},
+		{
+			input:    `var a = [1, 0] a[1] = a var b = [2, 0] b[1] = b a == b`,
+			expected: false,
+		},
+		{
+			input:    `var a = {"n": 1} a["self"] = a var b = {"n": 1} b["self"] = b a == b`,
+			expected: true,
+		},
+		{
+			input:    `var a = {"n": 1} a["self"] = a var b = {"n": 2} b["self"] = b a != b`,
+			expected: true,
+		},
+	}
+	runVmTests(t, tests)
+}
+
+func TestLogicalExpr(t *testing.T) {
+	tests := []vmTestCase{
+		{input: "true && true", expected: true},
+		{input: "true && false", expected: false},
+		{input: "false && true", expected: false},
+		{input: "false || true", expected: true},
+		{input: "false || false", expected: false},
+		{input: "1 < 2 && 2 < 3", expected: true},
+		{input: "1 > 2 || 2 > 3", expected: false},
+		// 结果为决定结果的操作数
+		{input: "1 && 2", expected: 2},
+		{input: `false || "a"`, expected: "a"},
+		{input: `0 || 1`, expected: 0},
+		{input: "var a = [1, 2] len(a) > 1 && a[1] > 1", expected: true},
+		{input: "var a = [] len(a) > 0 && a[0] > 1", expected: false},
+		{input: "if (false || 1 > 2 || true) { 10 } else { 20 }", expected: 10},
+		{input: "func f(x) { x > 0 && x < 10 } f(5) && !f(10)", expected: true},
+		// 不需要时不执行右侧
+		{input: "var n = 0 func inc() { n = n + 1 true } false && inc() n", expected: 0},
+		{input: "var n = 0 func inc() { n = n + 1 true } true || inc() n", expected: 0},
+		{input: "var n = 0 func inc() { n = n + 1 true } true && inc() false || inc() n", expected: 2},
+		{input: `false && 1 + "a"`, expected: false},
+		{input: `var s = 0 for (var i = 0; i < 10 && s < 10; i = i + 1) { s = s + i } s`, expected: 10},
 	}
 	runVmTests(t, tests)
 }
@@ -452,6 +709,18 @@ func TestCallFuncExpr(t *testing.T) {
 			`,
 			expected: 13,
 		},
+		{
+			// 函数内声明的函数不能破坏其他局部变量
+			input: `
+			func test() {
+				func one() { 1 }
+				var a = 5
+				one() + a
+			}
+			test()
+			`,
+			expected: 6,
+		},
 	}
 
 	runVmTests(t, tests)
@@ -503,6 +772,105 @@ func TestStringer(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestFloat(t *testing.T) {
+	tests := []vmTestCase{
+		{input: "1.5", expected: 1.5},
+		{input: "-2.25", expected: -2.25},
+		{input: "0.25 + 0.5", expected: 0.75},
+		{input: "1.5 * 2", expected: 3.0},
+		{input: "1 - 0.5", expected: 0.5},
+		{input: "7 / 2.0", expected: 3.5},
+		{input: "7 / 2", expected: 3},
+		{input: "7.5 % 2", expected: 1.5},
+		{input: "-7 % 2.5", expected: -2.0},
+		{input: "var price = 2.5 var qty = 3 price * qty", expected: 7.5},
+		{input: "1 == 1.0", expected: true},
+		{input: "1.0 != 1", expected: false},
+		{input: "0.5 < 1", expected: true},
+		{input: "2 <= 1.5", expected: false},
+		{input: "1.5 > 1", expected: true},
+		{input: "2.5 >= 2.5", expected: true},
+		{input: "int(2.9)", expected: 2},
+		{input: "int(-2.9)", expected: -2},
+		{input: "int(7)", expected: 7},
+		{input: `int("42")`, expected: 42},
+		{input: "float(3)", expected: 3.0},
+		{input: "float(0.5)", expected: 0.5},
+		{input: `float("1.25")`, expected: 1.25},
+		{input: "{1.5: 1, 1: 2}[1.5]", expected: 1},
+		// 整数值的浮点数与整数是同一个键, 与 1 == 1.0 一致
+		{input: "{1.5: 1, 1: 2}[1.0]", expected: 2},
+		{input: "{1.5: 1, 1: 2}[1.5 - 0.5]", expected: 2},
+		{input: `var m = {} m[2.0] = "a" m[2]`, expected: "a"},
+		{input: `len({1: "a", 1.0: "b"})`, expected: 1},
+		{input: `{0: "zero"}[-0.0]`, expected: "zero"},
+		{input: "{2: 1}[2.5]", expected: Nil},
+		{input: "{1: 2} == {1.0: 2}", expected: true},
+		{input: "if (0.0) { 1 } else { 2 }", expected: 1},
+	}
+	runVmTests(t, tests)
+
+	inspects := []struct {
+		input    string
+		expected string
+	}{
+		{input: "2.0", expected: "2.0"},
+		{input: "-0.5", expected: "-0.5"},
+		{input: "1.5 * 1000000", expected: "1500000.0"},
+		{input: "float(1000000000) * 1000000000000", expected: "1e+21"},
+		{input: "0.0000001", expected: "1e-07"},
+		{input: "[1, 2.5]", expected: "[1, 2.5]"},
+		// IEEE 754: 浮点数除零得到 ±Inf 或 NaN
+		{input: "var a = 0 1.5 / a", expected: "+Inf"},
+		{input: "var a = 0.0 var b = -1 b / a", expected: "-Inf"},
+		{input: "var a = 0.0 a / a", expected: "NaN"},
+		{input: "var a = 0.0 1 % a", expected: "NaN"},
+		{input: "var a = 0.0 var inf = 1 / a inf > 9223372036854775807", expected: "true"},
+		{input: "var a = 0.0 a / a == a / a", expected: "false"},
+		{input: "var a = 0.0 int(1 / a)", expected: "cannot convert +Inf to INT"},
+		{input: "int(float(9223372036854775807))", expected: "cannot convert 9223372036854776000.0 to INT"},
+		{input: `int("1.5")`, expected: `cannot convert "1.5" to INT`},
+		{input: `float("x")`, expected: `cannot convert "x" to FLOAT`},
+		{input: "float([])", expected: "argument to `float` not supported, got ARRAY"},
+	}
+	for _, test := range inspects {
+		comp := compiler.NewCompiler()
+		err := comp.Compiler(parse(test.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := NewVM(comp.Bytecode())
+		assert.NoError(t, vm.Run(), test.input)
+		assert.Equal(t, test.expected, vm.LastPoppedStackElem().Inspect(), test.input)
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "var a = 2.0 5 & a", expected: "1:15: unsupported types for operation INT FLOAT"},
+		{input: "var a = 2.0 a << 1", expected: "1:15: unsupported types for operation FLOAT INT"},
+		{input: "var a = 2.0 a < \"a\"", expected: "1:15: unknown operator FLOAT STRING"},
+	}
+	for _, test := range errTests {
+		comp := compiler.NewCompiler()
+		err := comp.Compiler(parse(test.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		assert.EqualError(t, NewVM(comp.Bytecode()).Run(), test.expected)
+	}
+
+	var buf bytes.Buffer
+	comp := compiler.NewCompiler()
+	err := comp.Compiler(parse(`print(1.0, 2.5 * 2, 10 / 4.0)`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	assert.NoError(t, NewVM(comp.Bytecode(), WithStdout(&buf)).Run())
+	assert.Equal(t, "1.0\n5.0\n2.5\n", buf.String())
+}
+
 func TestArray(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -607,11 +975,806 @@ func TestClosures(t *testing.T) {
 
 			expected: 0,
 		},
+		{
+			input: `
+			func pair() {
+				var n = 0
+				func inc() { n = n + 1 }
+				func get() { n }
+				return [inc, get]
+			}
+			var p = pair()
+			p[0]()
+			p[0]()
+			p[1]()
+			`,
+			expected: 2,
+		},
+		{
+			input: `
+			func test() {
+				var n = 1
+				func set(v) { n = v }
+				set(5)
+				n
+			}
+			test()
+			`,
+			expected: 5,
+		},
+		{
+			input: `
+			func outer() {
+				var n = 0
+				func mid() {
+					func inner() { n = n + 1 }
+					inner()
+					inner()
+				}
+				mid()
+				n
+			}
+			outer()
+			`,
+			expected: 2,
+		},
+		{
+			input: `
+			func counter() {
+				var n = 0
+				func inc() { n = n + 1 n }
+			}
+			var a = counter()
+			var b = counter()
+			a()
+			a()
+			b()
+			`,
+			expected: 1,
+		},
 	}
 
 	runVmTests(t, tests)
 }
 
+func TestLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input:    `var r = 1 while (false) { 2 } r`,
+			expected: 1,
+		},
+		{
+			input:    `while (true) { break } 1`,
+			expected: 1,
+		},
+		{
+			input:    `for (var i = 0; i < 10; i) { if (i == 0) { break } } i`,
+			expected: 0,
+		},
+		{
+			input:    `var n = 1 for (;;) { if (n == 1) { break } continue } n`,
+			expected: 1,
+		},
+		{
+			input: `
+			func find(x) {
+				while (true) {
+					for (;;) {
+						if (x > 1) { break } else { continue }
+					}
+					return x
+				}
+			}
+			find(5)
+			`,
+			expected: 5,
+		},
+		{
+			input: `
+			func test() {
+				var a = 1
+				for (var i = 0; i < 1; i) {
+					func inner() { a }
+					if (true) { var b = 2 }
+					break
+				}
+				a
+			}
+			test()
+			`,
+			expected: 1,
+		},
+		{
+			input:    `var n = 0 while (n < 5) { n = n + 1 } n`,
+			expected: 5,
+		},
+		{
+			// continue 跳到 post 语句, 只累加奇数
+			input:    `var s = 0 for (var i = 0; i < 10; i = i + 1) { if (i % 2 == 0) { continue } s = s + i } s`,
+			expected: 25,
+		},
+		{
+			// break 只跳出内层循环
+			input: `
+			var count = 0
+			for (var i = 0; i < 3; i = i + 1) {
+				for (var j = 0; j < 10; j = j + 1) {
+					if (j == 2) { break }
+					count = count + 1
+				}
+			}
+			count
+			`,
+			expected: 6,
+		},
+		{
+			input: `
+			func fib(n) {
+				var a = 0
+				var b = 1
+				while (n > 0) {
+					var t = a + b
+					a = b
+					b = t
+					n = n - 1
+				}
+				a
+			}
+			fib(10)
+			`,
+			expected: 55,
+		},
+		{
+			// 函数声明的值为闭包本身, 其后的 OpPop 不会破坏栈
+			input:    `func f() { 1 } f() + f()`,
+			expected: 2,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestAssignStmt(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input:    `var a = 1 a = a + 1 a`,
+			expected: 2,
+		},
+		{
+			input:    `var s = 0 for (var i = 0; i < 10; i = i + 1) { s = s + i } s`,
+			expected: 45,
+		},
+		{
+			input:    `var a = [1, 2, 3] a[1] = 5 a`,
+			expected: []int{1, 5, 3},
+		},
+		{
+			input:    `var m = {1: 1} m[2] = 2 m[1] = 3 m[1] + m[2]`,
+			expected: 5,
+		},
+		{
+			input: `
+			func sum(n) {
+				var s = 0
+				while (n > 0) {
+					s = s + n
+					n = n - 1
+				}
+				s
+			}
+			sum(4)
+			`,
+			expected: 10,
+		},
+		{
+			input: `
+			func counter() {
+				var n = 0
+				func inc() { n = n + 1 n }
+			}
+			var c = counter()
+			c()
+			c()
+			`,
+			expected: 2,
+		},
+	}
+
+	runVmTests(t, tests)
+
+	for _, input := range []string{`var a = [1] a[1] = 2`, `var a = 1 a[0] = 2`, `var m = {} m[[]] = 1`} {
+		comp := compiler.NewCompiler()
+		err := comp.Compiler(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		assert.Error(t, NewVM(comp.Bytecode()).Run())
+	}
+}
+
+func TestConstantFolding(t *testing.T) {
+	// 折叠前后运行结果必须一致
+	tests := []string{
+		`1 + 2 * 3 - 4 / 2`,
+		`-7 / 2`,
+		`!5`,
+		`!!false`,
+		`1 < 2`,
+		`(1 <= 2) == (3 >= 2)`,
+		`"ab" < "b"`,
+		`(1 && 2) || 3`,
+		`false && 1 / 0`,
+		`var a = 1 a > 0 || a`,
+		`(3 > 2) != (2 > 3)`,
+		`"a" + "b" + "c"`,
+		`("a" + "b" == "ab") != ("a" == "b")`,
+		`1.5 * 2 - 1 / 4.0`,
+		`(0.1 + 0.2 == 0.3) || (1 == 1.0)`,
+		`-7 % 3 + (12 & 10 | 1) ^ 3`,
+		`^5 << 3 >> 1`,
+		`if (1) { 2 } else { 3 }`,
+		`if (1 == 2) { 2 }`,
+		`if (true) { if (2 > 1) { 5 } }`,
+		`var a = 5 a * (2 + 3)`,
+		`func f(x) { return x + 2 * 3 } f(if (false) { 1 } else { 2 })`,
+	}
+
+	for _, input := range tests {
+		var results []object.Object
+		for _, folding := range []bool{false, true} {
+			comp := compiler.NewCompiler()
+			comp.SetConstantFolding(folding)
+			err := comp.Compiler(parse(input))
+			if err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+			vm := NewVM(comp.Bytecode())
+			assert.NoError(t, vm.Run())
+			results = append(results, vm.LastPoppedStackElem())
+		}
+		assert.Equal(t, results[0].Inspect(), results[1].Inspect(), input)
+	}
+}
+
+func TestPeephole(t *testing.T) {
+	// 窥孔优化前后运行结果(包括运行时错误)必须一致
+	tests := []string{
+		`1 2 3`,
+		`if (true) { 1 } else { 2 }`,
+		`if (false) { 1 }`,
+		`var a = 0 while (true) { a = a + 1 if (a > 5) { break } } a`,
+		`var s = 0 for (var i = 0; i < 10; i = i + 1) { if (i == 3) { continue } 7 s = s + i } s`,
+		`for (;;) { while (false) { 1 } break } 2`,
+		`func f(n) { if (n > 0) { return f(n - 1) } else { 1 } 5 } f(3)`,
+		`func f() { var x = 1 if (true) { "a" x } } f()`,
+		`func g() { while (true) { if (false) { 1 } else { return 2 } } } g()`,
+		`var m = {1: 2} m[1] = 3 if (false) { 0 } m[1]`,
+		`var s = "a" if (true) { 1 + s }`,
+		"func h(b) {\n  1\n  2 - b\n}\nh(\"b\")",
+		`var a = 1 if (a > 0 && true) { a || 2 } else { false }`,
+		`func k(x) { return x && k(false) } k(true)`,
+		`var b = false b || 1 2`,
+	}
+
+	for _, input := range tests {
+		for _, folding := range []bool{false, true} {
+			var results, errs []string
+			var sizes []int
+			for _, peephole := range []bool{false, true} {
+				comp := compiler.NewCompiler()
+				comp.SetConstantFolding(folding)
+				comp.SetPeephole(peephole)
+				err := comp.Compiler(parse(input))
+				if err != nil {
+					t.Fatalf("compiler error: %s", err)
+				}
+				bytecode := comp.Bytecode()
+				sizes = append(sizes, len(bytecode.Instructions))
+
+				vm := NewVM(bytecode)
+				err = vm.Run()
+				if err != nil {
+					errs = append(errs, err.Error())
+					results = append(results, "")
+					continue
+				}
+				errs = append(errs, "")
+				results = append(results, vm.LastPoppedStackElem().Inspect())
+			}
+			assert.Equal(t, results[0], results[1], input)
+			assert.Equal(t, errs[0], errs[1], input)
+			assert.LessOrEqual(t, sizes[1], sizes[0], input)
+		}
+	}
+}
+
+func TestTailCall(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input:    `func loop(n) { if (n == 0) { return 0 } return loop(n - 1) } loop(100000)`,
+			expected: 0,
+		},
+		{
+			input:    `func sum(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc + n) } } sum(10000, 0)`,
+			expected: 50005000,
+		},
+		{
+			input: `
+			var odd = 0
+			func even(n) { if (n == 0) { return true } return odd(n - 1) }
+			func isOdd(n) { if (n == 0) { return false } return even(n - 1) }
+			odd = isOdd
+			even(10001)
+			`,
+			expected: false,
+		},
+		{
+			input:    `func f(a) { return len(a) } f([1, 2])`,
+			expected: 2,
+		},
+		{
+			// 尾调用覆盖栈帧前需要关闭 upvalue
+			input:    `func f(n, prev) { func g() { n } if (n == 0) { return prev } return f(n - 1, g) } f(5, 0)()`,
+			expected: 1,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		input    string
+		opts     []Option
+		expected error
+	}{
+		{
+			input:    `func f(n) { f(n) + 1 } f(1)`,
+			opts:     []Option{WithStackSize(1 << 16)},
+			expected: ErrFrameOverflow,
+		},
+		{
+			input:    `func f(n) { f(n) + 1 } f(1)`,
+			expected: ErrStackOverflow,
+		},
+		{
+			input:    `func f(n) { if (n == 0) { 0 } else { f(n - 1) + 1 } } f(20)`,
+			opts:     []Option{WithFrameSize(10)},
+			expected: ErrFrameOverflow,
+		},
+		{
+			input: `func f(n) { if (n == 0) { 0 } else { f(n - 1) + 1 } } f(5)`,
+			opts:  []Option{WithFrameSize(10)},
+		},
+		{
+			input:    `[1, 2, 3, 4, 5]`,
+			opts:     []Option{WithStackSize(4)},
+			expected: ErrStackOverflow,
+		},
+		{
+			input:    `func f(a, b, c) { var d = 1 d } f(1, 2, 3)`,
+			opts:     []Option{WithStackSize(5)},
+			expected: ErrStackOverflow,
+		},
+		{
+			input:    `var a = 1 var b = 2 var c = 3`,
+			opts:     []Option{WithGlobalsSize(2)},
+			expected: ErrGlobalsOverflow,
+		},
+	}
+
+	for _, test := range tests {
+		comp := compiler.NewCompiler()
+		err := comp.Compiler(parse(test.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err = NewVM(comp.Bytecode(), test.opts...).Run()
+		if test.expected == nil {
+			assert.NoError(t, err, test.input)
+			continue
+		}
+		assert.True(t, errors.Is(err, test.expected), test.input)
+	}
+
+	comp := compiler.NewCompiler()
+	err := comp.Compiler(parse(`func f(n) { f(n) + 1 } f(1)`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	err = NewVM(comp.Bytecode(), WithFrameSize(100)).Run()
+	re, ok := err.(*RuntimeError)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, 100, len(re.Stack))
+	assert.Contains(t, re.StackTrace(), "\n\t... 80 frames omitted ...\n")
+}
+
+func TestReturnOutsideFunction(t *testing.T) {
+	// 编译器拒绝顶层 return, 手写的字节码在虚拟机中返回错误而不是 panic
+	for _, ins := range []code.Instructions{
+		append(code.Make(code.OpConstant, 0), code.Make(code.OpReturnValue)...),
+		code.Make(code.OpReturn),
+	} {
+		bytecode := &compiler.Bytecode{Instructions: ins, Constants: []object.Object{&object.Integer{Value: 1}}}
+		err := NewVM(bytecode).Run()
+		assert.True(t, errors.Is(err, ErrReturnOutside), ins.String())
+	}
+}
+
+func TestGas(t *testing.T) {
+	callCosts := &CostTable{}
+	callCosts[code.OpCall] = 50
+
+	tests := []struct {
+		input    string
+		opts     []Option
+		gasUsed  uint64
+		expected error
+	}{
+		{
+			input:   `1 + 2`,
+			opts:    []Option{WithBudget(100)},
+			gasUsed: 4,
+		},
+		{
+			input:    `while (true) { }`,
+			opts:     []Option{WithBudget(1000)},
+			gasUsed:  1001,
+			expected: ErrBudgetExceeded,
+		},
+		{
+			input:    `func f() { f() } f()`,
+			opts:     []Option{WithBudget(10000)},
+			gasUsed:  10007,
+			expected: ErrBudgetExceeded,
+		},
+		{
+			input:   `func f() { 1 } f() f()`,
+			opts:    []Option{WithBudget(100), WithCostTable(callCosts)},
+			gasUsed: 100,
+		},
+		{
+			input:    `func f() { 1 } f() f()`,
+			opts:     []Option{WithBudget(99), WithCostTable(callCosts)},
+			gasUsed:  100,
+			expected: ErrBudgetExceeded,
+		},
+		{
+			input: `func f() { 1 } f() f()`,
+			opts:  []Option{WithCostTable(callCosts)},
+		},
+	}
+
+	for _, test := range tests {
+		comp := compiler.NewCompiler()
+		err := comp.Compiler(parse(test.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := NewVM(comp.Bytecode(), test.opts...)
+		err = vm.Run()
+		assert.Equal(t, test.gasUsed, vm.GasUsed(), test.input)
+		if test.expected == nil {
+			assert.NoError(t, err, test.input)
+			continue
+		}
+		assert.True(t, errors.Is(err, test.expected), test.input)
+		assert.Contains(t, err.Error(), fmt.Sprintf("gas budget exceeded: used %d of", test.gasUsed))
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	tests := []string{
+		`while (true) { }`,
+		`for (;;) { var a = [1, 2, 3] }`,
+		`func f() { f() } f()`,
+		`func f() { while (true) { } } f() + 1`,
+	}
+
+	for _, input := range tests {
+		comp := compiler.NewCompiler()
+		err := comp.Compiler(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		err = NewVM(comp.Bytecode()).RunContext(ctx)
+		cancel()
+		assert.True(t, errors.Is(err, context.DeadlineExceeded), input)
+		re, ok := err.(*RuntimeError)
+		assert.Equal(t, ok, true)
+		assert.NotEmpty(t, re.Stack)
+	}
+
+	comp := compiler.NewCompiler()
+	err := comp.Compiler(parse(`1 + 2`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	vm := NewVM(comp.Bytecode())
+	assert.NoError(t, vm.RunContext(context.Background()))
+	testIntegerObject(t, 3, vm.LastPoppedStackElem())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = NewVM(comp.Bytecode()).RunContext(ctx)
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestMemoryLimit(t *testing.T) {
+	tests := []struct {
+		input    string
+		limit    uint64
+		used     uint64
+		expected error
+	}{
+		{input: `[1, 2, 3]`, limit: 1000, used: sizeArray + 3*sizeObject},
+		{input: `{1: 2}`, limit: 1000, used: sizeMap + sizeMapEntry},
+		{input: `"a" + "bc"`, used: sizeString + 3},
+		{input: `var s = "ab" while (true) { s = s + s }`, limit: 1 << 20, expected: ErrMemoryLimit},
+		{input: `var a = 0 for (;;) { a = [1, 2, 3, 4] }`, limit: 10000, expected: ErrMemoryLimit},
+		{input: `var m = {} var i = 0 while (true) { m[i] = i i = i + 1 }`, limit: 1 << 16, expected: ErrMemoryLimit},
+		{input: `var n = 0 while (true) { func f() { n } }`, limit: 1000, expected: ErrMemoryLimit},
+	}
+
+	for _, test := range tests {
+		comp := compiler.NewCompiler()
+		err := comp.Compiler(parse(test.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := NewVM(comp.Bytecode(), WithMemoryLimit(test.limit))
+		err = vm.Run()
+		if test.expected == nil {
+			assert.NoError(t, err, test.input)
+			assert.Equal(t, test.used, vm.MemoryUsed(), test.input)
+			continue
+		}
+		assert.True(t, errors.Is(err, test.expected), test.input)
+		assert.Greater(t, vm.MemoryUsed(), test.limit, test.input)
+		assert.LessOrEqual(t, vm.MemoryUsed(), 2*test.limit, test.input)
+	}
+
+	// 内置函数返回的对象同样计入内存
+	builtins := compiler.DefaultBuiltins()
+	assert.NoError(t, builtins.RegisterFunc("zeros", func(n int64) []int64 { return make([]int64, n) }))
+	assert.NoError(t, builtins.RegisterFunc("same", func(a object.Object) object.Object { return a }))
+	builtinTests := []struct {
+		input    string
+		limit    uint64
+		used     uint64
+		expected error
+	}{
+		{input: `zeros(2)`, used: sizeArray + 2*sizeObject},
+		{input: `len([1, 2])`, used: sizeArray + 2*sizeObject},
+		{input: `var a = [1] same(a)`, used: sizeArray + sizeObject},
+		{input: `zeros(100000)`, limit: 1 << 20, expected: ErrMemoryLimit},
+		{input: `while (true) { zeros(100) }`, limit: 1 << 16, expected: ErrMemoryLimit},
+	}
+	for _, test := range builtinTests {
+		comp := compiler.NewCompilerWithBuiltins(builtins)
+		err := comp.Compiler(parse(test.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := NewVM(comp.Bytecode(), WithBuiltins(builtins), WithMemoryLimit(test.limit))
+		err = vm.Run()
+		if test.expected == nil {
+			assert.NoError(t, err, test.input)
+			assert.Equal(t, test.used, vm.MemoryUsed(), test.input)
+			continue
+		}
+		assert.True(t, errors.Is(err, test.expected), test.input)
+	}
+}
+
+func TestCall(t *testing.T) {
+	// 宿主调用脚本返回的闭包
+	comp := compiler.NewCompiler()
+	err := comp.Compiler(parse(`
+	func adder(a) { func add(b) { a + b } }
+	func fail(x) { x + "a" }
+	{"inc": adder(1), "fail": fail}`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	vm := NewVM(comp.Bytecode())
+	assert.NoError(t, vm.Run())
+	callbacks := vm.LastPoppedStackElem().(*object.Map)
+	inc := callbacks.Elements[(&object.Stringer{Value: "inc"}).MapKey()].Value
+	fail := callbacks.Elements[(&object.Stringer{Value: "fail"}).MapKey()].Value
+
+	for i := 0; i < 3; i++ {
+		result, err := vm.Call(inc, &object.Integer{Value: int64(i)})
+		assert.NoError(t, err)
+		testIntegerObject(t, int64(i+1), result)
+	}
+	result, err := vm.Call(compiler.DefaultBuiltins().Get(0), &object.Array{})
+	assert.NoError(t, err)
+	testIntegerObject(t, 0, result)
+
+	_, err = vm.Call(fail, &object.Integer{Value: 1})
+	re, ok := err.(*RuntimeError)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, "fail", re.Stack[0].Name)
+	_, err = vm.Call(inc)
+	assert.Error(t, err)
+	_, err = vm.Call(&object.Integer{Value: 1})
+	assert.Error(t, err)
+	// 出错后虚拟机仍可继续使用
+	result, err = vm.Call(inc, &object.Integer{Value: 41})
+	assert.NoError(t, err)
+	testIntegerObject(t, 42, result)
+
+	// 内置函数回调脚本中的闭包
+	builtins := compiler.DefaultBuiltins()
+	assert.NoError(t, builtins.Register("apply", compiler.Variadic, func(rt compiler.Runtime, args ...object.Object) (object.Object, error) {
+		return rt.Call(args[0], args[1:]...)
+	}))
+	tests := []vmTestCase{
+		{
+			input:    `func double(x) { x * 2 } apply(double, 21) + 1`,
+			expected: 43,
+		},
+		{
+			input:    `func add(a, b) { a + b } func f(x) { apply(add, x, apply(add, x, 1)) } f(2) + f(3)`,
+			expected: 12,
+		},
+		{
+			input:    `func fib(n) { if (n < 2) { return n } apply(fib, n - 1) + apply(fib, n - 2) } fib(10)`,
+			expected: 55,
+		},
+		{
+			input:    `var n = 0 func inc() { n = n + 1 } apply(inc) apply(inc) apply(len, [n, n, n])`,
+			expected: 3,
+		},
+	}
+	for _, test := range tests {
+		comp := compiler.NewCompilerWithBuiltins(builtins)
+		err := comp.Compiler(parse(test.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := NewVM(comp.Bytecode(), WithBuiltins(builtins))
+		assert.NoError(t, vm.Run(), test.input)
+		testExpectedObject(t, test.expected, vm.LastPoppedStackElem())
+	}
+
+	// 回调中的错误终止整个虚拟机
+	comp = compiler.NewCompilerWithBuiltins(builtins)
+	err = comp.Compiler(parse(`func bad() { 1 + "a" } apply(bad)`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	err = NewVM(comp.Bytecode(), WithBuiltins(builtins)).Run()
+	re, ok = err.(*RuntimeError)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, []string{"bad", "main"}, []string{re.Stack[0].Name, re.Stack[1].Name})
+}
+
+func TestBuiltinsRegistry(t *testing.T) {
+	double := func(_ compiler.Runtime, args ...object.Object) (object.Object, error) {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}, nil
+	}
+	sum := func(_ compiler.Runtime, args ...object.Object) (object.Object, error) {
+		var total int64
+		for _, arg := range args {
+			total += arg.(*object.Integer).Value
+		}
+		return &object.Integer{Value: total}, nil
+	}
+	fail := func(_ compiler.Runtime, args ...object.Object) (object.Object, error) {
+		return nil, errors.New("host failure")
+	}
+
+	builtins := compiler.NewBuiltins()
+	assert.NoError(t, builtins.Register("double", 1, double))
+	assert.NoError(t, builtins.Register("sum", compiler.Variadic, sum))
+	assert.NoError(t, builtins.Register("fail", 0, fail))
+	assert.Error(t, builtins.Register("sum", 1, sum))
+	assert.Equal(t, []string{"double", "sum", "fail"}, builtins.Names())
+
+	tests := []struct {
+		input    string
+		expected interface{}
+		err      string
+	}{
+		{input: `double(21)`, expected: 42},
+		{input: `sum() + sum(1, 2, 3)`, expected: 6},
+		{input: `double(1, 2)`, err: "1:7: wrong number of arguments to double: want=1, got=2"},
+		{input: `fail()`, err: "1:5: host failure"},
+	}
+	for _, test := range tests {
+		comp := compiler.NewCompilerWithBuiltins(builtins)
+		err := comp.Compiler(parse(test.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := NewVM(comp.Bytecode(), WithBuiltins(builtins))
+		err = vm.Run()
+		if test.err != "" {
+			assert.EqualError(t, err, test.err, test.input)
+			continue
+		}
+		assert.NoError(t, err, test.input)
+		testExpectedObject(t, test.expected, vm.LastPoppedStackElem())
+	}
+
+	// 默认注册表中不存在的函数在编译时报错
+	comp := compiler.NewCompiler()
+	assert.Error(t, comp.Compiler(parse(`double(1)`)))
+	// 不同虚拟机可以使用不同的函数集合, 编号相同时调用各自的实现
+	other := compiler.NewBuiltins()
+	assert.NoError(t, other.Register("double", 1, sum))
+	comp = compiler.NewCompilerWithBuiltins(builtins)
+	err := comp.Compiler(parse(`double(21)`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	vm := NewVM(comp.Bytecode(), WithBuiltins(other))
+	assert.NoError(t, vm.Run())
+	testIntegerObject(t, 21, vm.LastPoppedStackElem())
+
+	// 编号对应的函数名不一致时拒绝运行
+	comp = compiler.NewCompilerWithBuiltins(builtins)
+	err = comp.Compiler(parse(`sum(1, 2)`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	vm = NewVM(comp.Bytecode(), WithBuiltins(other))
+	assert.Equal(t, true, errors.Is(vm.Run(), compiler.ErrBuiltinMismatch))
+	_, err = vm.Call(builtins.Get(0))
+	assert.Equal(t, true, errors.Is(err, compiler.ErrBuiltinMismatch))
+}
+
+func TestOutput(t *testing.T) {
+	comp := compiler.NewCompiler()
+	err := comp.Compiler(parse(`func f(n) { print(n, "done") } f(1) f(2)`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	// 并发运行的虚拟机输出到各自的 buffer
+	buffers := make([]*bytes.Buffer, 8)
+	errs := make(chan error, len(buffers))
+	for i := range buffers {
+		buffers[i] = &bytes.Buffer{}
+		go func(out *bytes.Buffer) {
+			errs <- NewVM(bytecode, WithStdout(out)).Run()
+		}(buffers[i])
+	}
+	for range buffers {
+		assert.NoError(t, <-errs)
+	}
+	for _, out := range buffers {
+		assert.Equal(t, "1\ndone\n2\ndone\n", out.String())
+	}
+
+	// 自定义内置函数使用 stdin/stderr
+	builtins := compiler.DefaultBuiltins()
+	assert.NoError(t, builtins.RegisterFunc("readline", func(rt compiler.Runtime) (string, error) {
+		var line string
+		_, err := fmt.Fscanln(rt.Stdin(), &line)
+		return line, err
+	}))
+	assert.NoError(t, builtins.RegisterFunc("warn", func(rt compiler.Runtime, msg string) error {
+		_, err := fmt.Fprintln(rt.Stderr(), "warning:", msg)
+		return err
+	}))
+	comp = compiler.NewCompilerWithBuiltins(builtins)
+	err = comp.Compiler(parse(`var name = readline() warn(name) print("hello " + name)`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	vm := NewVM(comp.Bytecode(), WithBuiltins(builtins),
+		WithStdin(bytes.NewBufferString("mini\n")), WithStdout(stdout), WithStderr(stderr))
+	assert.NoError(t, vm.Run())
+	assert.Equal(t, "hello mini\n", stdout.String())
+	assert.Equal(t, "warning: mini\n", stderr.String())
+}
+
 func runVmTests(t *testing.T, tests []vmTestCase) {
 	t.Helper()
 
@@ -629,3 +1792,113 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 		testExpectedObject(t, test.expected, stackElem)
 	}
 }
+
+func TestBytecodeSerialization(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input:    "(1 * 2 + 3 - 4) * 10 / 2",
+			expected: 5,
+		},
+		{
+			input:    `"mini" + "-" + "compiler"`,
+			expected: "mini-compiler",
+		},
+		{
+			input:    "[1, 2, 3]",
+			expected: []int{1, 2, 3},
+		},
+		{
+			input:    "0.5 * 3 + 1",
+			expected: 2.5,
+		},
+		{
+			input:    `func test1(a) {func test2(b) { func test3(c) {return a + b + c} return test3} return test2} test1(1)(2)(3)`,
+			expected: 6,
+		},
+	}
+
+	for _, test := range tests {
+		comp := compiler.NewCompiler()
+		err := comp.Compiler(parse(test.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		buf := bytes.Buffer{}
+		assert.NoError(t, comp.Bytecode().Encode(&buf))
+		bytecode, err := compiler.Decode(&buf)
+		assert.NoError(t, err)
+
+		vm := NewVM(bytecode)
+		assert.NoError(t, vm.Run())
+		testExpectedObject(t, test.expected, vm.LastPoppedStackElem())
+	}
+}
+
+func TestRuntimeErrorPosition(t *testing.T) {
+	tests := []struct {
+		input    string
+		file     string
+		expected string
+	}{
+		{
+			input:    `1 + "a"`,
+			expected: "1:3: unsupported types for operation INT STRING",
+		},
+		{
+			input:    "var a = 1\nfunc add(b) {\n\treturn a + b\n}\nadd(\"a\")",
+			file:     "add.mini",
+			expected: "add.mini:3:11: unsupported types for operation INT STRING",
+		},
+		{
+			input:    "func add(a, b) { a + b }\n\n  add(1)",
+			file:     "add.mini",
+			expected: "add.mini:3:6: wrong number of arguments: want=2, got=1",
+		},
+	}
+
+	for _, test := range tests {
+		comp := compiler.NewCompiler()
+		comp.SetFile(test.file)
+		err := comp.Compiler(parse(test.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := NewVM(comp.Bytecode())
+		err = vm.Run()
+		assert.Error(t, err)
+		assert.Equal(t, test.expected, err.Error())
+	}
+}
+
+func TestRuntimeErrorStackTrace(t *testing.T) {
+	input := `func outer(a) {
+	func inner(b) {
+		return a + b
+	}
+	return inner("b") + 1
+}
+outer(1)`
+
+	comp := compiler.NewCompiler()
+	comp.SetFile("trace.mini")
+	err := comp.Compiler(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	err = NewVM(comp.Bytecode()).Run()
+
+	re, ok := err.(*RuntimeError)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, "unsupported types for operation INT STRING", re.Message)
+	assert.Equal(t, code.OpAdd, re.Op)
+	assert.Equal(t, []StackFrame{
+		{Name: "inner", Offset: 4, File: "trace.mini", Pos: token.Position{Line: 3, Column: 12}},
+		{Name: "outer", Offset: 16, File: "trace.mini", Pos: token.Position{Line: 5, Column: 14}},
+		{Name: "main", Offset: 17, File: "trace.mini", Pos: token.Position{Line: 7, Column: 6}},
+	}, re.Stack)
+	assert.Equal(t, `trace.mini:3:12: unsupported types for operation INT STRING (OpAdd)
+	at inner (trace.mini:3:12) [0004]
+	at outer (trace.mini:5:14) [0016]
+	at main (trace.mini:7:6) [0017]`, re.StackTrace())
+}